@@ -0,0 +1,50 @@
+#!/bin/bash
+# Issue a certificate for one node, for use with --mtls. The node's ring
+# identifier is the SHA-1 of the certificate's public key.
+#
+# usage: generate_node_cert.sh <name> [ip ...]
+# writes <name>-key.pem and <name>-cert.pem next to this script, signed by
+# the CA from generate_certs.sh
+
+if [ -z "$1" ]; then
+    echo "usage: $0 <name> [ip ...]"
+    exit 1
+fi
+NAME=$1
+shift
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+cd "$SCRIPT_DIR"
+
+if [ ! -f ca-cert.pem ] || [ ! -f ca-key.pem ]; then
+    echo "no CA found, run generate_certs.sh first"
+    exit 1
+fi
+
+SAN="DNS:localhost,IP:127.0.0.1"
+for ip in "$@"; do
+    SAN="$SAN,IP:$ip"
+done
+
+openssl genrsa -out "$NAME-key.pem" 4096
+
+# the same certificate serves incoming calls and authenticates outgoing ones
+cat > "$NAME-ext.cnf" <<EXT
+subjectAltName = $SAN
+extendedKeyUsage = serverAuth,clientAuth
+EXT
+
+openssl req -new -key "$NAME-key.pem" -out "$NAME-csr.pem" \
+    -subj "/C=SE/ST=Stockholm/L=Stockholm/O=Chord/CN=$NAME"
+
+openssl x509 -req -days 365 -in "$NAME-csr.pem" \
+    -CA ca-cert.pem -CAkey ca-key.pem -CAcreateserial \
+    -out "$NAME-cert.pem" \
+    -extfile "$NAME-ext.cnf"
+
+rm -f "$NAME-ext.cnf" "$NAME-csr.pem"
+
+echo ""
+echo "Node identifier:"
+openssl x509 -in "$NAME-cert.pem" -pubkey -noout | openssl pkey -pubin -outform DER | openssl sha1 -r | cut -d' ' -f1
+echo "Certificate for $NAME generated in $SCRIPT_DIR"
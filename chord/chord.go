@@ -0,0 +1,1042 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "chord/protocol" // Update path as needed
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultPort = "3410"
+
+	// how long we wait for a peer to answer, unless overridden per method
+	defaultTimeout = 5 * time.Second
+	//successorListSize = 20
+	keySize = sha1.Size * 8
+)
+
+var (
+	two     = big.NewInt(2)
+	hashMod = new(big.Int).Exp(big.NewInt(2), big.NewInt(keySize), nil)
+
+	// errTimeout is wrapped into the error of every call a peer did not
+	// answer in time, so maintenance can tell a hung peer from other errors
+	errTimeout = errors.New("timed out")
+
+	// per method timeouts; liveness checks should fail fast while bulk
+	// transfers get more time
+	defaultTimeouts = map[string]time.Duration{
+		"Ping":           time.Second,
+		"GetPredecessor": 2 * time.Second,
+		"Notify":         2 * time.Second,
+		"Leave":          2 * time.Second,
+		"FindSuccessor":  5 * time.Second,
+		"Get":            10 * time.Second,
+		"Put":            10 * time.Second,
+		"Delete":         10 * time.Second,
+		"PutStream":      time.Minute,
+		"GetStream":      time.Minute,
+		"GetAll":         30 * time.Second,
+		"ListKeys":       30 * time.Second,
+		"MerkleTree":     10 * time.Second,
+		"MerkleKeys":     10 * time.Second,
+	}
+)
+
+// Node represents a node in the Chord DHT
+type Node struct {
+	pb.UnimplementedChordServer
+	mu sync.RWMutex
+
+	Address     string
+	Predecessor NodeRef
+	Successors  []NodeRef
+
+	FingerTable []NodeRef
+	Identifier  *big.Int
+
+	Bucket    Store
+	bucketMu  sync.Mutex    // orders the read-compare-write in store
+	bucketGen atomic.Uint64 // counts the writes to Bucket, see merkleTree
+
+	clockMu sync.Mutex
+	clock   uint64 // Lamport clock for the versions of our writes
+
+	SuccessorListSize int
+
+	// files are stored in chunks of ChunkSize bytes, and the progress of
+	// uploads is kept in UploadDir so that they can be resumed
+	ChunkSize int
+	UploadDir string
+	// Dedup stores files by their content, so that identical files and
+	// chunks are stored once
+	Dedup bool
+	// NameKey, if set, hides the names of the files we store and look up
+	// from the nodes holding them, see fileKey
+	NameKey []byte
+	// Identity, if set, is our X25519 key, for reading files shared with
+	// us
+	Identity *ecdh.PrivateKey
+
+	// every key is written to Replicas nodes; a write needs WriteQuorum of
+	// them to acknowledge it and a read ReadQuorum of them to answer
+	Replicas    int
+	ReadQuorum  int
+	WriteQuorum int
+
+	// what maintainReplicas last brought up to date: our predecessor, the
+	// successors holding our replicas, and when it last went over every key
+	replicaMu       sync.Mutex
+	replicaPred     string
+	replicaHolders  []string
+	replicasChecked time.Time
+	// ranges of keys new predecessors took over from us, which we only
+	// keep if we are a replica of them
+	released []keyRange
+
+	// anti-entropy: what it repaired, and the Merkle trees of our keys
+	// built since the last write to Bucket
+	repairs     repairCounters
+	merkleMu    sync.Mutex
+	merkleGen   uint64
+	merkleCache map[string]*merkleTree
+
+	server     *grpc.Server
+	httpServer *http.Server // the gateway, if Config.HTTPAddress is set
+	httpAddr   net.Addr
+	transport  Transport
+	ring       *ringCache // set on the node of a Client, which is not in the ring
+
+	// how the node was set up by New, and what Stop has to wind down
+	config   Config
+	cancel   context.CancelFunc // stops the maintenance goroutines
+	loops    sync.WaitGroup
+	stopOnce sync.Once
+
+	// verifyCallers makes Notify and Leave check the caller's certificate
+	// against the identifier it claims
+	verifyCallers bool
+}
+
+// Item is a value in the bucket along with its version. Deleted keys stay
+// behind as tombstones, so that a lagging replica cannot bring them back.
+type Item struct {
+	Value   []byte
+	Version Version
+	Deleted bool
+}
+
+// NodeRef points at another node in the ring: where to reach it and where
+// it sits on the ring. The zero value means "no node".
+type NodeRef struct {
+	Address    string
+	Identifier *big.Int
+}
+
+// newNodeRef builds a reference from the wire format. Peers that do not send
+// an identifier are assumed to use the hash of their address.
+func newNodeRef(address string, id []byte) NodeRef {
+	if address == "" {
+		return NodeRef{}
+	}
+	if len(id) == 0 {
+		return NodeRef{Address: address, Identifier: hash(address)}
+	}
+	return NodeRef{Address: address, Identifier: new(big.Int).SetBytes(id)}
+}
+
+// IsZero reports whether the reference is empty
+func (r NodeRef) IsZero() bool {
+	return r.Address == ""
+}
+
+// idBytes returns the identifier in wire format
+func (r NodeRef) idBytes() []byte {
+	if r.Identifier == nil {
+		return nil
+	}
+	return r.Identifier.Bytes()
+}
+
+// rangeBound encodes an identifier bounding a range of keys as a fixed
+// width byte string, so that even the zero id is distinguishable from "no
+// bound"
+func rangeBound(id *big.Int) []byte {
+	return id.FillBytes(make([]byte, sha1.Size))
+}
+
+// id returns the identifier of this node on the ring
+func (n *Node) id() *big.Int {
+	if n.Identifier != nil {
+		return n.Identifier
+	}
+	return hash(n.Address)
+}
+
+// peer returns the node at address
+func (n *Node) peer(address string) Peer {
+	return n.transport.Peer(address)
+}
+
+// self returns a reference to this node
+func (n *Node) self() NodeRef {
+	return NodeRef{Address: n.Address, Identifier: n.id()}
+}
+
+// get the sha1 hash of a string as a bigint
+func hash(elt string) *big.Int {
+	hasher := sha1.New()
+	hasher.Write([]byte(elt))
+	return new(big.Int).SetBytes(hasher.Sum(nil))
+}
+
+// calculate the address of a point somewhere across the ring
+// this gets the target point for a given finger table entry
+// the successor of this point is the finger table entry
+func jump(n *big.Int, fingerentry int) *big.Int {
+	fingerentryminus1 := big.NewInt(int64(fingerentry) - 1)
+	distance := new(big.Int).Exp(two, fingerentryminus1, nil)
+
+	sum := new(big.Int).Add(n, distance)
+
+	return new(big.Int).Mod(sum, hashMod)
+}
+
+// returns true if elt is between start and end, accounting for the right
+// if inclusive is true, it can match the end
+func between(start, elt, end *big.Int, inclusive bool) bool {
+	if end.Cmp(start) > 0 {
+		return (start.Cmp(elt) < 0 && elt.Cmp(end) < 0) || (inclusive && elt.Cmp(end) == 0)
+	} else {
+		return start.Cmp(elt) < 0 || elt.Cmp(end) < 0 || (inclusive && elt.Cmp(end) == 0)
+	}
+}
+
+// Ping implements the Ping RPC method
+func (n *Node) Ping(ctx context.Context, req *pb.PingRequest) (*pb.PingResponse, error) {
+	//log.Print("ping: received request")
+	return &pb.PingResponse{}, nil
+}
+
+// store saves item under key unless we already hold the same or a newer
+// version of it, which may be a delete. It reports whether the item was
+// stored. If expected is set and we hold a version newer than expected,
+// the write conflicts with one we already have and fails with errConflict.
+func (n *Node) store(key string, item Item, expected *Version) (bool, error) {
+	n.observe(item.Version)
+	n.bucketMu.Lock()
+	defer n.bucketMu.Unlock()
+	old, exists, err := n.Bucket.Get(key)
+	if err != nil {
+		return false, err
+	}
+	if exists && expected != nil && expected.Less(old.Version) {
+		return false, fmt.Errorf("%w: %s is at version %s, newer than %s", errConflict, key, old.Version, expected)
+	}
+	if exists && !old.Version.Less(item.Version) {
+		return false, nil
+	}
+	defer n.bucketGen.Add(1)
+	if err := n.Bucket.Put(key, item); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Put implements the Put RPC method
+func (n *Node) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
+	//log.Print("put: [", req.Key, "] => [", req.Value, "]")
+	item := Item{Value: req.Value, Version: versionFromProto(req.Version)}
+	if _, err := n.store(req.Key, item, expectedFromProto(req.Expected)); err != nil {
+		return nil, storeError("put", err)
+	}
+	return &pb.PutResponse{}, nil
+}
+
+// Get implements the Get RPC method
+func (n *Node) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	item, exists, err := n.Bucket.Get(req.Key)
+	if err != nil {
+		return nil, fmt.Errorf("get: %v", err)
+	}
+	if !exists {
+		//log.Print("get: [", req.Key, "] miss")
+		return &pb.GetResponse{Value: nil}, nil
+	}
+	if item.Deleted {
+		return &pb.GetResponse{Version: item.Version.toProto(), Deleted: true, Found: true}, nil
+	}
+	if req.VersionOnly {
+		return &pb.GetResponse{Version: item.Version.toProto(), Found: true}, nil
+	}
+	//log.Print("get: [", req.Key, "] found [", value, "]")
+	return &pb.GetResponse{Value: item.Value, Version: item.Version.toProto(), Found: true}, nil
+}
+
+// Delete implements the Delete RPC method
+func (n *Node) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	//log.Print("delete: [", req.Key, "]")
+	item := Item{Version: versionFromProto(req.Version), Deleted: true}
+	if _, err := n.store(req.Key, item, expectedFromProto(req.Expected)); err != nil {
+		return nil, storeError("delete", err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+// inRange returns whether a key lies in the range of a GetAll or ListKeys
+// request: (start, end], or everywhere without a range
+func inRange(start, end []byte) func(key string) bool {
+	if len(start) == 0 && len(end) == 0 {
+		return func(string) bool { return true }
+	}
+	s, e := new(big.Int).SetBytes(start), new(big.Int).SetBytes(end)
+	return func(key string) bool { return between(s, hash(key), e, true) }
+}
+
+// GetAll implements the GetAll RPC method
+func (n *Node) GetAll(req *pb.GetAllRequest, stream pb.Chord_GetAllServer) error {
+	keys, err := n.keys(inRange(req.Start, req.End))
+	if err != nil {
+		return fmt.Errorf("getall: %v", err)
+	}
+	return sendItems(keys, func(k string) (*pb.Item, error) {
+		item, ok, err := n.Bucket.Get(k)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return &pb.Item{Key: k, Value: item.Value, Version: item.Version.toProto(), Deleted: item.Deleted}, nil
+	}, stream.Send)
+}
+
+// how many keys go into one frame of a ListKeys
+const listBatchSize = 1000
+
+// ListKeys implements the ListKeys RPC method
+func (n *Node) ListKeys(req *pb.ListKeysRequest, stream pb.Chord_ListKeysServer) error {
+	wanted := inRange(req.Start, req.End)
+	var keys []*pb.KeyInfo
+	err := n.Bucket.RangeKeys(func(k string, item Item) bool {
+		if wanted(k) && (!req.FilesOnly || isFileKey(k)) {
+			keys = append(keys, &pb.KeyInfo{Key: k, Version: item.Version.toProto(), Deleted: item.Deleted, Size: -1})
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("listkeys: %v", err)
+	}
+	// the size of a file is in its manifest; chunks are never read
+	for _, k := range keys {
+		if k.Deleted || !isFileKey(k.Key) {
+			continue
+		}
+		item, ok, err := n.Bucket.Get(k.Key)
+		if err != nil {
+			return fmt.Errorf("listkeys: %v", err)
+		}
+		if ok && !item.Deleted {
+			k.Size = storedSize(item.Value)
+		}
+	}
+	for len(keys) > 0 {
+		batch := keys[:min(listBatchSize, len(keys))]
+		keys = keys[len(batch):]
+		if err := stream.Send(&pb.ListKeysResponse{Keys: batch}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeError turns an error from store into what the RPC returns, so that
+// the caller can tell a conflict from a failure
+func storeError(op string, err error) error {
+	if errors.Is(err, errConflict) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return fmt.Errorf("%s: %v", op, err)
+}
+
+// pushItem copies one of our items to the node at address. With expected
+// set, the node refuses it if it holds a version newer than expected.
+func (n *Node) pushItem(ctx context.Context, address string, key string, item Item, expected *Version) error {
+	if item.Deleted {
+		return n.peer(address).Delete(ctx, key, item.Version, expected)
+	}
+	// large values, like chunks of files, are sent in frames
+	if len(item.Value) > streamFrameSize {
+		return n.peer(address).PutStream(ctx, key, item.Value, item.Version, expected)
+	}
+	return n.peer(address).Put(ctx, key, item.Value, item.Version, expected)
+}
+
+// StoreFile encrypts a local file chunk by chunk, spreads the chunks over
+// the ring and writes a manifest listing them to the replicas of its name.
+// The result says which replicas acknowledged the manifest. If the upload
+// fails part way, storing the same file again resumes it. If somebody else
+// stores the same name at the same time, one of the two writes fails with
+// errConflict.
+func (n *Node) StoreFile(ctx context.Context, filepath string, password string) (QuorumResult, error) {
+	return n.storeFile(ctx, filepath, password, nil)
+}
+
+// StoreFileIf is StoreFile for a read-modify-write: it fails with
+// errConflict if the file has changed since it was read at version
+// expected. The zero version means the file must not exist.
+func (n *Node) StoreFileIf(ctx context.Context, filepath string, password string, expected Version) (QuorumResult, error) {
+	return n.storeFile(ctx, filepath, password, &expected)
+}
+
+// DeleteFile removes a file from all the replicas StoreFile wrote to. Each
+// of them keeps a tombstone, so a replica that missed the delete cannot
+// bring the file back. A file that does not exist fails with errNotFound,
+// and nothing is written for it.
+func (n *Node) DeleteFile(ctx context.Context, filename string) (QuorumResult, error) {
+	return n.deleteFile(ctx, filename, nil)
+}
+
+// DeleteFileIf is DeleteFile, unless the file has changed since it was
+// read at version expected
+func (n *Node) DeleteFileIf(ctx context.Context, filename string, expected Version) (QuorumResult, error) {
+	return n.deleteFile(ctx, filename, &expected)
+}
+
+func (n *Node) deleteFile(ctx context.Context, filename string, expected *Version) (QuorumResult, error) {
+	key := n.fileKey(filename)
+	cur, err := n.read(ctx, key)
+	if err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to delete file: %w", err)
+	}
+	if expected == nil {
+		if !cur.Found || cur.Item.Deleted {
+			return cur.QuorumResult, fmt.Errorf("failed to delete file: %s: %w", filename, errNotFound)
+		}
+		expected = &cur.Item.Version
+	}
+	res, err := n.write(ctx, key, nil, true, expected)
+	if err != nil {
+		return res, fmt.Errorf("failed to delete file: %w", err)
+	}
+	if cur.Found && cur.Item.Version == *expected {
+		n.dropChunks(ctx, cur.Item)
+	}
+	return res, nil
+}
+
+// announce pushes every item we hold back to the nodes now responsible for
+// it. A node that restarts with a persistent store may have missed writes
+// and deletes, and its keys may have moved while it was away; writes are
+// ordered by version, so nobody loses anything newer than what we send.
+func (n *Node) announce(ctx context.Context) {
+	keys, err := n.keys(func(string) bool { return true })
+	if err != nil {
+		log.Printf("announce: failed to read our keys: %v", err)
+		return
+	}
+	failed := 0
+	for _, k := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+		item, ok, err := n.Bucket.Get(k)
+		if err == nil && ok {
+			_, err = n.replicate(ctx, k, item, nil)
+		}
+		if err != nil {
+			log.Printf("announce: %s: %v", k, err)
+			failed++
+		}
+	}
+	if len(keys) > 0 {
+		log.Printf("announce: re-announced %d keys, %d failed", len(keys)-failed, failed)
+	}
+}
+
+// keys returns the keys we hold for which wanted is true, without reading
+// their values
+func (n *Node) keys(wanted func(key string) bool) ([]string, error) {
+	var keys []string
+	err := n.Bucket.RangeKeys(func(k string, _ Item) bool {
+		if wanted(k) {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	return keys, err
+}
+
+func (n *Node) checkPredecessor(ctx context.Context) {
+	n.mu.RLock()
+	pred := n.Predecessor
+	n.mu.RUnlock()
+	if pred.IsZero() {
+		return
+	}
+	err := n.peer(pred.Address).Ping(ctx)
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	if isTimeout(err) {
+		log.Printf("checkPredecessor: predecessor %s timed out, clearing it", pred.Address)
+	} else {
+		log.Printf("error ping: %s", err)
+	}
+	n.mu.Lock()
+	n.Predecessor = NodeRef{}
+	n.mu.Unlock()
+}
+
+// newNode sets up a node that is not part of any ring yet. A nil id means
+// the hash of address.
+func newNode(address string, id *big.Int, successorListSize int, store Store, transport Transport) *Node {
+	return &Node{
+		Address:           address,
+		FingerTable:       make([]NodeRef, keySize+1),
+		Bucket:            store,
+		SuccessorListSize: successorListSize,
+		Replicas:          min(defaultReplicas, successorListSize+1),
+		ReadQuorum:        defaultReadQuorum,
+		WriteQuorum:       defaultWriteQuorum,
+		ChunkSize:         defaultChunkSize,
+		UploadDir:         filepath.Join(os.TempDir(), "chord-uploads"),
+		Identifier:        id,
+		transport:         transport,
+	}
+}
+
+func (n *Node) create() {
+	n.mu.Lock()
+	n.Predecessor = NodeRef{}
+	n.Successors = []NodeRef{n.self()}
+	n.mu.Unlock()
+	//log.Printf("create: created new Chord network at %s", n.Address)
+}
+
+func (n *Node) join(ctx context.Context, nprime string) error {
+	succ, err := n.peer(nprime).FindSuccessor(ctx, n.id())
+	if err != nil {
+		log.Printf("join: FindSuccessor call failed: %v", err)
+		return err
+	}
+
+	n.mu.Lock()
+	n.Successors = []NodeRef{succ}
+	n.mu.Unlock()
+
+	// pull our keys before notifying, while succ still knows the predecessor
+	// that bounds our range
+	n.takeOverKeys(ctx, succ)
+
+	errr := n.peer(succ.Address).Notify(ctx, n.self())
+	if errr != nil {
+		// stabilize notifies succ again, so we are in the ring anyway
+		log.Printf("join: Notify call failed: %v", errr)
+		return nil
+	}
+	log.Printf("join: joined the network via %s, my successor is %s", nprime, succ.Address)
+	return nil
+}
+
+// takeOverKeys pulls the keys in (predecessor of succ, self] from our new
+// successor, which has been holding them until now. Once we notify it, the
+// successor keeps its copies only as far as it is one of our replicas, see
+// releaseRange.
+func (n *Node) takeOverKeys(ctx context.Context, succ NodeRef) {
+	if succ.Address == n.Address {
+		return
+	}
+	// without a predecessor on succ, everything up to us that succ does not
+	// own itself is ours
+	start := succ.Identifier
+	peer := n.peer(succ.Address)
+	if nb, err := peer.GetPredecessor(ctx); err == nil && !nb.Predecessor.IsZero() && nb.Predecessor.Address != n.Address {
+		start = nb.Predecessor.Identifier
+	}
+
+	items, err := peer.GetAll(ctx, start, n.id())
+	if err != nil {
+		log.Printf("join: GetAll call failed: %v", err)
+		return
+	}
+	for k, item := range items {
+		if _, err := n.store(k, item, nil); err != nil {
+			log.Printf("join: failed to store %s: %v", k, err)
+		}
+	}
+	if len(items) > 0 {
+		log.Printf("join: took over %d keys from %s", len(items), succ.Address)
+	}
+}
+func (n *Node) FindSuccessor(ctx context.Context, req *pb.FindSuccessorRequest) (*pb.FindSuccessorRespons, error) {
+	targetId := new(big.Int).SetBytes(req.Id)
+
+	n.mu.RLock()
+	if len(n.Successors) == 0 || n.Successors[0].IsZero() {
+		n.mu.RUnlock()
+		return &pb.FindSuccessorRespons{Adress: n.Address, Identifier: n.id().Bytes()}, nil
+	}
+	myHash := n.id()
+	succ := n.Successors[0]
+	n.mu.RUnlock()
+
+	// If target is between me and my successor, return my successor
+	if between(myHash, targetId, succ.Identifier, true) {
+		return &pb.FindSuccessorRespons{Adress: succ.Address, Identifier: succ.idBytes()}, nil
+	}
+
+	// Otherwise, forward to the closest preceding node, falling back to the
+	// next best one whenever a hop is dead
+	var lastErr error
+	for _, next := range n.closestPrecedingNodes(targetId) {
+		ref, err := n.peer(next.Address).FindSuccessor(ctx, targetId)
+		if err != nil {
+			//log.Printf("FindSuccessor: call to %s failed: %v", next.Address, err)
+			if ctx.Err() != nil {
+				// our caller gave up, there is no point in trying the others
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+			lastErr = err
+			continue
+		}
+		return &pb.FindSuccessorRespons{Adress: ref.Address, Identifier: ref.idBytes()}, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+
+	// nobody we know of precedes the target, so our successor is the best guess
+	return &pb.FindSuccessorRespons{Adress: succ.Address, Identifier: succ.idBytes()}, nil
+}
+
+// closestPrecedingNodes returns the nodes from the finger table and the
+// successor list that lie strictly between this node and id, closest to id
+// first. The first entry is the classic closest preceding node, the rest
+// are fallbacks in case it is dead.
+func (n *Node) closestPrecedingNodes(id *big.Int) []NodeRef {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	myHash := n.id()
+	seen := map[string]bool{n.Address: true, "": true}
+	var candidates []NodeRef
+	for _, ref := range n.FingerTable {
+		if !seen[ref.Address] {
+			seen[ref.Address] = true
+			candidates = append(candidates, ref)
+		}
+	}
+	for _, ref := range n.Successors {
+		if !seen[ref.Address] {
+			seen[ref.Address] = true
+			candidates = append(candidates, ref)
+		}
+	}
+
+	// keep only nodes in (me, id) and sort them by how far they are from me,
+	// farthest (i.e. closest to id) first
+	distance := func(ref NodeRef) *big.Int {
+		d := new(big.Int).Sub(ref.Identifier, myHash)
+		return d.Mod(d, hashMod)
+	}
+	var result []NodeRef
+	for _, ref := range candidates {
+		if between(myHash, ref.Identifier, id, false) {
+			result = append(result, ref)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return distance(result[i]).Cmp(distance(result[j])) > 0
+	})
+	return result
+}
+
+func (n *Node) stabilize(ctx context.Context) {
+	// find the first live successor, dropping dead ones from the list
+	var succ NodeRef
+	var nb Neighbours
+	for {
+		n.mu.Lock()
+		if len(n.Successors) == 0 {
+			//log.Printf("Found no alive successors")
+			n.Successors = []NodeRef{n.self()}
+		}
+		succ = n.Successors[0]
+		n.mu.Unlock()
+
+		var err error
+		nb, err = n.getPredecessorOf(ctx, succ)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if isTimeout(err) {
+			log.Printf("stabilize: successor %s timed out, dropping it", succ.Address)
+		} else {
+			log.Printf("stabilize: successor %s is dead, dropping it", succ.Address)
+		}
+		n.mu.Lock()
+		if len(n.Successors) > 0 && n.Successors[0].Address == succ.Address {
+			n.Successors = n.Successors[1:]
+		}
+		n.mu.Unlock()
+	}
+
+	// if a node joined between us and our successor, it is our new successor
+	x := nb.Predecessor
+	if !x.IsZero() && x.Address != n.Address && between(n.id(), x.Identifier, succ.Identifier, false) {
+		if xnb, err := n.getPredecessorOf(ctx, x); err == nil {
+			succ, nb = x, xnb
+		}
+	}
+
+	// our successor list is our successor followed by its successor list,
+	// stopping once the list wraps around to us
+	successors := append([]NodeRef{succ}, nb.Successors...)
+	for i, ref := range successors {
+		if ref.Address == n.Address {
+			successors = successors[:i+1]
+			break
+		}
+	}
+	if len(successors) > n.SuccessorListSize {
+		successors = successors[:n.SuccessorListSize]
+	}
+	n.mu.Lock()
+	n.Successors = successors
+	n.mu.Unlock()
+
+	if succ.Address != n.Address {
+		err := n.peer(succ.Address).Notify(ctx, n.self())
+		if err != nil {
+			//log.Printf("stabilize: notify call failed: %v", err)
+		}
+	}
+}
+
+// getPredecessorOf asks ref for its predecessor and successor list,
+// answering locally when ref is this node
+func (n *Node) getPredecessorOf(ctx context.Context, ref NodeRef) (Neighbours, error) {
+	if ref.Address == n.Address {
+		return n.neighbours(), nil
+	}
+	return n.peer(ref.Address).GetPredecessor(ctx)
+}
+
+// neighbours returns our own place in the ring
+func (n *Node) neighbours() Neighbours {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return Neighbours{
+		Self:        n.self(),
+		Predecessor: n.Predecessor,
+		Successors:  append([]NodeRef(nil), n.Successors...),
+	}
+}
+
+func (n *Node) Notify(ctx context.Context, req *pb.NotifyRequest) (*pb.NotifyResponse, error) {
+	candidate := newNodeRef(req.Address, req.Identifier)
+	if err := n.checkCaller(ctx, candidate); err != nil {
+		log.Printf("notify: rejected %s: %v", req.Address, err)
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	//log.Printf("notify: received notification from %s", req.Address)
+	if req.Address == "" || req.Address == n.Predecessor.Address || req.Address == n.Address {
+		return &pb.NotifyResponse{}, nil
+	}
+	if n.Predecessor.IsZero() || between(n.Predecessor.Identifier, candidate.Identifier, n.id(), false) {
+		log.Printf("notify: updating predecessor from %s to %s", n.Predecessor.Address, req.Address)
+		if !n.Predecessor.IsZero() {
+			// the candidate took over (old predecessor, candidate] when it
+			// joined, see takeOverKeys
+			n.releaseRange(n.Predecessor.Identifier, candidate.Identifier)
+		}
+		n.Predecessor = candidate
+	}
+
+	return &pb.NotifyResponse{}, nil
+}
+
+// Leave implements the Leave RPC method
+func (n *Node) Leave(ctx context.Context, req *pb.LeaveRequest) (*pb.LeaveResponse, error) {
+	leaving := neighboursFromLeave(req)
+	if err := n.checkCaller(ctx, leaving.Self); err != nil {
+		log.Printf("leave: rejected %s: %v", req.Address, err)
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	log.Printf("leave: %s is leaving the ring", req.Address)
+
+	// our predecessor is leaving: its predecessor is ours now
+	if n.Predecessor.Address == req.Address {
+		n.Predecessor = leaving.Predecessor
+		if n.Predecessor.Address == n.Address {
+			n.Predecessor = NodeRef{}
+		}
+	}
+
+	// our successor is leaving: its successor list replaces ours, otherwise
+	// just forget about it
+	var successors []NodeRef
+	if len(n.Successors) > 0 && n.Successors[0].Address == req.Address {
+		successors = leaving.Successors
+	} else {
+		successors = n.Successors
+	}
+	var kept []NodeRef
+	for _, ref := range successors {
+		if ref.Address == req.Address {
+			continue
+		}
+		kept = append(kept, ref)
+		if ref.Address == n.Address || len(kept) == n.SuccessorListSize {
+			break
+		}
+	}
+	if len(kept) == 0 {
+		kept = []NodeRef{n.self()}
+	}
+	n.Successors = kept
+
+	return &pb.LeaveResponse{}, nil
+}
+
+// LeaveRing hands our keys to our successor, links our neighbours to each
+// other and stops the node
+func (n *Node) LeaveRing(ctx context.Context) error {
+	n.mu.RLock()
+	self := n.self()
+	pred := n.Predecessor
+	successors := append([]NodeRef(nil), n.Successors...)
+	n.mu.RUnlock()
+	keys, err := n.keys(func(k string) bool {
+		// our own keys, or everything if we do not know where our range starts
+		return pred.IsZero() || between(pred.Identifier, hash(k), self.Identifier, true)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read our keys: %v", err)
+	}
+
+	// hand our keys to the first successor that takes them all
+	var heir NodeRef
+	for _, succ := range successors {
+		if succ.IsZero() || succ.Address == n.Address {
+			continue
+		}
+		var err error
+		for _, k := range keys {
+			err = n.push(ctx, succ.Address, k)
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			log.Printf("leave: failed to hand keys to %s: %v", succ.Address, err)
+			continue
+		}
+		heir = succ
+		break
+	}
+	if heir.IsZero() && len(keys) > 0 {
+		return fmt.Errorf("no live successor to hand %d keys to", len(keys))
+	}
+
+	// tell our neighbours about each other
+	leaving := Neighbours{Self: self, Predecessor: pred, Successors: successors}
+	if !heir.IsZero() {
+		if err := n.peer(heir.Address).Leave(ctx, leaving); err != nil {
+			log.Printf("leave: failed to notify successor %s: %v", heir.Address, err)
+		}
+	}
+	if !pred.IsZero() && pred.Address != n.Address && pred.Address != heir.Address {
+		if err := n.peer(pred.Address).Leave(ctx, leaving); err != nil {
+			log.Printf("leave: failed to notify predecessor %s: %v", pred.Address, err)
+		}
+	}
+	log.Printf("leave: handed %d keys to %s", len(keys), heir.Address)
+
+	return n.Stop(ctx)
+}
+
+// Lookup reads filename from its replicas as stored, that is encrypted.
+// The result says which node is responsible for it and which replicas
+// answered.
+func (n *Node) Lookup(ctx context.Context, filename string) (ReadResult, error) {
+	res, err := n.read(ctx, filename)
+	if err != nil {
+		log.Printf("Lookup: %v", err)
+		return res, err
+	}
+	return res, nil
+}
+
+// FetchFile decrypts the file name into w as it arrives, with the password
+// or, for a file shared with us, our Identity. The result says whether the
+// file was found.
+func (n *Node) FetchFile(ctx context.Context, name string, password string, w io.Writer) (ReadResult, error) {
+	return n.fetchFile(ctx, name, password, w)
+}
+
+// LookupFile reads filename like Lookup and decrypts it with password. It
+// returns nil data if the file does not exist.
+func (n *Node) LookupFile(ctx context.Context, filename string, password string) ([]byte, ReadResult, error) {
+	var buf bytes.Buffer
+	res, err := n.fetchFile(ctx, filename, password, &buf)
+	if err != nil || !res.Found {
+		if err != nil {
+			log.Printf("LookupFile: %v", err)
+		}
+		return nil, res, err
+	}
+	// an empty file is still there
+	return append([]byte{}, buf.Bytes()...), res, nil
+
+}
+
+// isTimeout reports whether err means a peer did not answer in time
+func isTimeout(err error) bool {
+	return errors.Is(err, errTimeout)
+}
+
+// GetPredecessor implements the GetPredecessor RPC method
+func (n *Node) GetPredecessor(ctx context.Context, req *pb.GetPredecessorRequest) (*pb.GetPredecessorResponse, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	resp := &pb.GetPredecessorResponse{
+		Address:        n.Predecessor.Address,
+		PredIdentifier: n.Predecessor.idBytes(),
+		Identifier:     n.id().Bytes(),
+	}
+	for _, succ := range n.Successors {
+		resp.Successors = append(resp.Successors, succ.Address)
+		resp.SuccessorIdentifiers = append(resp.SuccessorIdentifiers, succ.idBytes())
+	}
+	return resp, nil
+}
+
+func (n *Node) fixFingers(ctx context.Context, nextFinger int) int {
+	nextFinger = (nextFinger % keySize) + 1
+
+	// Calculate the target position for this finger
+	target := jump(n.id(), nextFinger)
+
+	// Find the successor of that position using your own FindSuccessor
+
+	resp, err := n.FindSuccessor(ctx, &pb.FindSuccessorRequest{Id: target.Bytes()})
+	if err != nil {
+		log.Printf("fixFingers: FindSuccessor failed for finger %d: %v", nextFinger, err)
+		return nextFinger - 1
+	}
+
+	// Update the finger table entry
+	n.mu.Lock()
+	n.FingerTable[nextFinger] = newNodeRef(resp.Adress, resp.Identifier)
+	n.mu.Unlock()
+
+	return nextFinger
+}
+func addrwithid(a string, id *big.Int) string {
+	if a == "" {
+		return "(empty)"
+	}
+	s := fmt.Sprintf("%040x", id)
+	return s[:8] + ".. (" + a + ")"
+}
+
+// format a node reference for printing
+func addr(ref NodeRef) string {
+	return addrwithid(ref.Address, ref.Identifier)
+}
+
+// String shows the start of the identifier and the address
+func (r NodeRef) String() string {
+	return addr(r)
+}
+
+// Dump writes useful info about the local node to w
+func (n *Node) Dump(w io.Writer) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Dump: information about this node")
+
+	// predecessor and successor links
+	fmt.Fprintln(w, "Neighborhood")
+	fmt.Fprintln(w, "pred:   ", addr(n.Predecessor))
+	fmt.Fprintln(w, "self:   ", addr(n.self()))
+	for i, succ := range n.Successors {
+		if succ.IsZero() {
+			continue
+		}
+		fmt.Fprintf(w, "succ  %d: %s\n", i, addr(succ))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Finger table")
+	i := 1
+	for i <= keySize {
+		for i < keySize && n.FingerTable[i].Address == n.FingerTable[i+1].Address {
+			i++
+		}
+		if i > keySize {
+			break
+		}
+		if !n.FingerTable[i].IsZero() {
+			fmt.Fprintf(w, " [%3d]: %s\n", i, addr(n.FingerTable[i]))
+		}
+		i++
+	}
+	fmt.Fprintln(w)
+
+	if n.Identifier != nil {
+		fmt.Fprintf(w, "identifier: %040x\n", n.Identifier)
+		fmt.Fprintln(w)
+
+	}
+	fmt.Fprintln(w, "Data items")
+	err := n.Bucket.Range(func(k string, item Item) bool {
+		s := fmt.Sprintf("%040x", hash(k))
+		if item.Deleted {
+			fmt.Fprintf(w, "    %s.. %s (deleted)\n", s[:8], k)
+			return true
+		}
+		fmt.Fprintf(w, "    %s.. %s (%d bytes)\n", s[:8], k, len(item.Value))
+		return true
+	})
+	if err != nil {
+		fmt.Fprintln(w, "    error reading items:", err)
+	}
+	fmt.Fprintln(w)
+
+	stats := n.RepairStats()
+	fmt.Fprintln(w, "Anti-entropy")
+	fmt.Fprintf(w, "    %d rounds, %d keys differed: %d pulled, %d pushed, %d failed\n", stats.Rounds, stats.Differing, stats.Pulled, stats.Pushed, stats.Failed)
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,935 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testRingSize      = 50
+	testSuccessorList = 4
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every join and failure they notice
+	log.SetOutput(io.Discard)
+	// a key is derived for every file stored or looked up; the real cost
+	// would make the tests crawl
+	defaultKDF = kdfParams{Time: 1, Memory: 64, Threads: 1}
+	os.Exit(m.Run())
+}
+
+// testRing is a ring of nodes wired together by a memTransport. Nothing
+// runs in the background: the test drives maintenance itself.
+type testRing struct {
+	t         *testing.T
+	transport *memTransport
+	nodes     []*Node
+	down      map[string]bool
+}
+
+// newTestRing creates a ring and joins size-1 more nodes to it one by one,
+// letting the ring settle after each join
+func newTestRing(t *testing.T, size int) *testRing {
+	t.Helper()
+	r := &testRing{t: t, transport: newMemTransport(), down: make(map[string]bool)}
+	first := r.add()
+	first.create()
+	for i := 1; i < size; i++ {
+		r.join(first.Address)
+	}
+	r.fixFingers()
+	r.checkRing()
+	return r
+}
+
+// add registers a new node with the transport, outside the ring
+func (r *testRing) add() *Node {
+	return r.addWithID(nil)
+}
+
+// addWithID is add for a node with an explicit identifier, or the hash of
+// its address if id is nil
+func (r *testRing) addWithID(id *big.Int) *Node {
+	n := newNode(fmt.Sprintf("node-%02d:%s", len(r.nodes), defaultPort), id, testSuccessorList, newMemStore(), r.transport)
+	n.UploadDir = r.t.TempDir()
+	r.transport.register(n)
+	r.nodes = append(r.nodes, n)
+	return n
+}
+
+// join adds a node that joins through the node at nprime
+func (r *testRing) join(nprime string) *Node {
+	n := r.add()
+	n.join(context.Background(), nprime)
+	r.settle()
+	return n
+}
+
+// kill makes a node unreachable without telling anyone
+func (r *testRing) kill(n *Node) {
+	r.transport.setDown(n.Address, true)
+	r.down[n.Address] = true
+}
+
+// live returns the nodes that are up, in ring order
+func (r *testRing) live() []*Node {
+	var live []*Node
+	for _, n := range r.nodes {
+		if !r.down[n.Address] {
+			live = append(live, n)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].id().Cmp(live[j].id()) < 0 })
+	return live
+}
+
+// owner returns the live node responsible for id
+func (r *testRing) owner(id *big.Int) *Node {
+	live := r.live()
+	for _, n := range live {
+		if n.id().Cmp(id) >= 0 {
+			return n
+		}
+	}
+	return live[0]
+}
+
+// replicasOf returns the live nodes that should hold key, in ring order
+// starting with the node responsible for it
+func (r *testRing) replicasOf(key string) []*Node {
+	live := r.live()
+	owner := r.owner(hash(key))
+	var replicas []*Node
+	for i, n := range live {
+		if n != owner {
+			continue
+		}
+		for j := 0; j < min(owner.Replicas, len(live)); j++ {
+			replicas = append(replicas, live[(i+j)%len(live)])
+		}
+	}
+	return replicas
+}
+
+// settle runs the maintenance rounds until every live node has the right
+// neighbours, and fails the test if that does not happen
+func (r *testRing) settle() {
+	r.t.Helper()
+	ctx := context.Background()
+	for round := 0; round < 3*len(r.nodes); round++ {
+		if r.ringError() == nil {
+			return
+		}
+		for _, n := range r.live() {
+			n.checkPredecessor(ctx)
+			n.stabilize(ctx)
+		}
+	}
+	r.checkRing()
+}
+
+// fixFingers refreshes every finger of every live node
+func (r *testRing) fixFingers() {
+	ctx := context.Background()
+	for _, n := range r.live() {
+		next := 0
+		for i := 0; i < keySize; i++ {
+			next = n.fixFingers(ctx, next)
+		}
+	}
+}
+
+func (r *testRing) checkRing() {
+	r.t.Helper()
+	if err := r.ringError(); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// ringError describes the first live node whose predecessor or successor
+// list does not match the ring order
+func (r *testRing) ringError() error {
+	live := r.live()
+	for i, n := range live {
+		pred := live[(i+len(live)-1)%len(live)]
+		if len(live) > 1 && n.Predecessor.Address != pred.Address {
+			return fmt.Errorf("%s: predecessor is %q, want %s", n.Address, n.Predecessor.Address, pred.Address)
+		}
+		// in a small ring the list wraps around to the node itself
+		want := min(testSuccessorList, len(live))
+		if len(n.Successors) != want {
+			return fmt.Errorf("%s: has %d successors, want %d", n.Address, len(n.Successors), want)
+		}
+		for j, succ := range n.Successors {
+			next := live[(i+1+j)%len(live)]
+			if succ.Address != next.Address {
+				return fmt.Errorf("%s: successor %d is %s, want %s", n.Address, j, succ.Address, next.Address)
+			}
+		}
+	}
+	return nil
+}
+
+func TestJoinBuildsRing(t *testing.T) {
+	r := newTestRing(t, testRingSize)
+	if got := len(r.live()); got != testRingSize {
+		t.Fatalf("ring has %d nodes, want %d", got, testRingSize)
+	}
+}
+
+func TestFingersPointAtSuccessors(t *testing.T) {
+	r := newTestRing(t, testRingSize)
+	for _, n := range r.live() {
+		for i := 1; i <= keySize; i++ {
+			want := r.owner(jump(n.id(), i))
+			if got := n.FingerTable[i].Address; got != want.Address {
+				t.Fatalf("%s: finger %d is %s, want %s", n.Address, i, got, want.Address)
+			}
+		}
+	}
+}
+
+func TestLookupFromEveryNode(t *testing.T) {
+	r := newTestRing(t, testRingSize)
+	ctx := context.Background()
+	rnd := rand.New(rand.NewSource(1))
+	for k := 0; k < 50; k++ {
+		key := new(big.Int).Rand(rnd, hashMod)
+		want := r.owner(key)
+		for _, n := range r.live() {
+			resp, err := n.FindSuccessor(ctx, &pb.FindSuccessorRequest{Id: key.Bytes()})
+			if err != nil {
+				t.Fatalf("%s: FindSuccessor(%040x): %v", n.Address, key, err)
+			}
+			if resp.Adress != want.Address {
+				t.Fatalf("%s: FindSuccessor(%040x) = %s, want %s", n.Address, key, resp.Adress, want.Address)
+			}
+		}
+	}
+}
+
+func TestRingSurvivesFailures(t *testing.T) {
+	r := newTestRing(t, testRingSize)
+	live := r.live()
+
+	// scattered failures, and a run as long as the successor list allows
+	for _, i := range []int{3, 17, 31} {
+		r.kill(live[i])
+	}
+	for i := 40; i < 40+testSuccessorList-1; i++ {
+		r.kill(live[i])
+	}
+	r.settle()
+	r.fixFingers()
+
+	ctx := context.Background()
+	rnd := rand.New(rand.NewSource(2))
+	for k := 0; k < 20; k++ {
+		key := new(big.Int).Rand(rnd, hashMod)
+		want := r.owner(key)
+		for _, n := range r.live() {
+			resp, err := n.FindSuccessor(ctx, &pb.FindSuccessorRequest{Id: key.Bytes()})
+			if err != nil {
+				t.Fatalf("%s: FindSuccessor(%040x): %v", n.Address, key, err)
+			}
+			if resp.Adress != want.Address {
+				t.Fatalf("%s: FindSuccessor(%040x) = %s, want %s", n.Address, key, resp.Adress, want.Address)
+			}
+		}
+	}
+}
+
+func TestLookupRoutesAroundStaleFingers(t *testing.T) {
+	r := newTestRing(t, testRingSize)
+	live := r.live()
+	r.kill(live[10])
+	r.kill(live[25])
+	r.settle()
+	// fingers still point at the dead nodes
+
+	ctx := context.Background()
+	for _, n := range r.live() {
+		for _, dead := range []*Node{live[10], live[25]} {
+			want := r.owner(dead.id())
+			resp, err := n.FindSuccessor(ctx, &pb.FindSuccessorRequest{Id: dead.id().Bytes()})
+			if err != nil {
+				t.Fatalf("%s: FindSuccessor: %v", n.Address, err)
+			}
+			if resp.Adress != want.Address {
+				t.Fatalf("%s: FindSuccessor = %s, want %s", n.Address, resp.Adress, want.Address)
+			}
+		}
+	}
+}
+
+func TestRingFollowsExplicitIdentifiers(t *testing.T) {
+	r := &testRing{t: t, transport: newMemTransport(), down: make(map[string]bool)}
+	ctx := context.Background()
+
+	// closely spaced identifiers around the hash of a key, nothing like the
+	// hashes of the addresses: the key falls between the fourth and fifth
+	const key = "placed"
+	base := new(big.Int).Sub(hash(key), big.NewInt(35))
+	for i := 0; i < 8; i++ {
+		n := r.addWithID(new(big.Int).Add(base, big.NewInt(int64(10*i))))
+		if i == 0 {
+			n.create()
+			continue
+		}
+		n.join(ctx, r.nodes[0].Address)
+		r.settle()
+	}
+	r.fixFingers()
+
+	for _, n := range r.nodes {
+		for _, want := range r.nodes {
+			for _, offset := range []int64{-5, 0} {
+				// below the first node is the end of the ring, past the last
+				id := new(big.Int).Add(want.id(), big.NewInt(offset))
+				got, err := r.transport.Peer(n.Address).FindSuccessor(ctx, id)
+				if err != nil || got.Address != want.Address {
+					t.Fatalf("%s: FindSuccessor(%040x) = %s, %v; want %s", n.Address, id, got.Address, err, want.Address)
+				}
+			}
+		}
+	}
+
+	res, err := r.nodes[6].replicate(ctx, key, Item{Value: []byte(key), Version: Version{Clock: 1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Owner.Address != r.nodes[4].Address {
+		t.Errorf("%s is owned by %s, want %s", key, res.Owner.Address, r.nodes[4].Address)
+	}
+	if _, ok, _ := r.nodes[4].Bucket.Get(key); !ok {
+		t.Errorf("%s is not on its owner %s", key, r.nodes[4].Address)
+	}
+}
+
+// hang makes calls to the nodes wait for their deadline or cancellation,
+// like a peer that takes connections but never answers
+func (r *testRing) hang(nodes ...*Node) {
+	hung := make(map[string]bool)
+	for _, n := range nodes {
+		hung[n.Address] = true
+	}
+	r.transport.setIntercept(func(ctx context.Context, address, _ string) error {
+		if !hung[address] {
+			return nil
+		}
+		<-ctx.Done()
+		return status.FromContextError(ctx.Err()).Err()
+	})
+}
+
+func TestHungPeersTimeOut(t *testing.T) {
+	r := newTestRing(t, 10)
+	ctx := context.Background()
+	const timeout = 50 * time.Millisecond
+	r.transport.timeouts = map[string]time.Duration{"FindSuccessor": timeout, "GetPredecessor": timeout, "Get": timeout}
+	live := r.live()
+	pred, hung, next := live[4], live[5], live[6]
+	// a key the hung node is the second replica of
+	key := "hung-key"
+	for i := 0; r.owner(hash(key)) != pred; i++ {
+		key = fmt.Sprintf("hung-key-%d", i)
+	}
+	if _, err := r.nodes[0].replicate(ctx, key, Item{Value: []byte(key), Version: Version{Clock: 1}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	r.hang(hung)
+
+	// a call to the hung peer gives up after its deadline
+	start := time.Now()
+	_, err := r.transport.Peer(hung.Address).FindSuccessor(ctx, hash(key))
+	if !isTimeout(err) {
+		t.Fatalf("FindSuccessor on a hung peer: got %v, want a timeout", err)
+	}
+	if took := time.Since(start); took < timeout || took > 10*timeout {
+		t.Errorf("FindSuccessor on a hung peer took %v, its timeout is %v", took, timeout)
+	}
+
+	// a lookup that runs into it ends with its deadline instead of hanging
+	for _, n := range r.live() {
+		if n == hung {
+			continue
+		}
+		start := time.Now()
+		resp, err := n.FindSuccessor(ctx, &pb.FindSuccessorRequest{Id: next.id().Bytes()})
+		if (err != nil && !isTimeout(err)) || (err == nil && resp.Adress != next.Address) {
+			t.Errorf("%s: FindSuccessor with %s hung = %v, %v; want %s or a timeout", n.Address, hung.Address, resp, err, next.Address)
+		}
+		if took := time.Since(start); took > 10*timeout {
+			t.Errorf("%s: FindSuccessor with %s hung took %v", n.Address, hung.Address, took)
+		}
+	}
+
+	// a read asks the next replica once one times out
+	live[0].ReadQuorum = 2
+	res, err := live[0].read(ctx, key)
+	if err != nil || !res.Found {
+		t.Fatalf("read with a replica hung: found %v, %v", res.Found, err)
+	}
+	if !slices.ContainsFunc(res.Replicas, func(rep Replica) bool { return rep.Node.Address == hung.Address && isTimeout(rep.Err) }) {
+		t.Errorf("read did not time out on the hung replica: %+v", res.Replicas)
+	}
+
+	// and stabilize drops it as a successor
+	start = time.Now()
+	pred.stabilize(ctx)
+	if pred.Successors[0].Address != next.Address {
+		t.Errorf("after stabilize the successor of %s is %s, want %s", pred.Address, pred.Successors[0].Address, next.Address)
+	}
+	if took := time.Since(start); took > 10*timeout {
+		t.Errorf("stabilize past a hung successor took %v", took)
+	}
+}
+
+func TestCancelReachesHungCalls(t *testing.T) {
+	r := newTestRing(t, 10)
+	live := r.live()
+	hung := live[5]
+	// a key the hung node is a replica of, read from all of them
+	key := "cancel-key"
+	for i := 0; r.owner(hash(key)) != live[4]; i++ {
+		key = fmt.Sprintf("cancel-key-%d", i)
+	}
+	live[0].ReadQuorum = 3
+	r.hang(hung)
+
+	// with the default timeouts of seconds, only the cancel ends the calls
+	for name, call := range map[string]func(context.Context) error{
+		"FindSuccessor": func(ctx context.Context) error {
+			_, err := r.transport.Peer(hung.Address).FindSuccessor(ctx, hash(key))
+			return err
+		},
+		"stabilize": func(ctx context.Context) error {
+			live[4].stabilize(ctx)
+			return ctx.Err()
+		},
+		"read": func(ctx context.Context) error {
+			_, err := live[0].read(ctx, key)
+			return err
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		start := time.Now()
+		err := call(ctx)
+		if err == nil || isTimeout(err) {
+			t.Errorf("%s after cancel: got %v, want it canceled", name, err)
+		}
+		if took := time.Since(start); took > time.Second {
+			t.Errorf("%s took %v to notice the cancel", name, took)
+		}
+	}
+	// stabilize gave up rather than dropping a successor it never heard from
+	if live[4].Successors[0].Address != hung.Address {
+		t.Errorf("a canceled stabilize dropped %s", hung.Address)
+	}
+}
+
+// writeTestFile creates a file to store and returns its path
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestStoreFileReplicates(t *testing.T) {
+	r := newTestRing(t, testRingSize)
+	ctx := context.Background()
+	data := []byte("the quick brown fox")
+	file := writeTestFile(t, "fox.txt", data)
+
+	res, err := r.nodes[7].StoreFile(ctx, file, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the owner and the nodes after it hold a copy, and nobody else
+	owner := r.owner(hash("fox.txt"))
+	holders := r.replicasOf("fox.txt")
+	if got := len(res.Answered()); got != len(holders) {
+		t.Errorf("%d replicas acknowledged the write, want %d", got, len(holders))
+	}
+	if res.Owner.Address != owner.Address {
+		t.Errorf("write went to owner %s, want %s", res.Owner.Address, owner.Address)
+	}
+	for _, n := range r.nodes {
+		_, ok, _ := n.Bucket.Get("fox.txt")
+		if want := slices.Contains(holders, n); ok != want {
+			t.Errorf("%s holds a copy: %v, want %v", n.Address, ok, want)
+		}
+	}
+
+	got, lookup, err := r.nodes[30].LookupFile(ctx, "fox.txt", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookup.Owner.Address != owner.Address {
+		t.Errorf("LookupFile found the file on %s, want %s", lookup.Owner.Address, owner.Address)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("LookupFile = %q, want %q", got, data)
+	}
+	if _, _, err := r.nodes[30].LookupFile(ctx, "fox.txt", "wrong"); err == nil {
+		t.Error("LookupFile with the wrong password succeeded")
+	}
+
+	// once the owner fails, its successor serves the replica
+	r.kill(owner)
+	r.settle()
+	r.fixFingers()
+	got, lookup, err = r.nodes[30].LookupFile(ctx, "fox.txt", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookup.Owner.Address == owner.Address {
+		t.Errorf("LookupFile still routes to the failed owner")
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("LookupFile after failure = %q, want %q", got, data)
+	}
+}
+
+func TestWriteQuorum(t *testing.T) {
+	r := newTestRing(t, 10)
+	ctx := context.Background()
+	client := r.nodes[0]
+	client.WriteQuorum = client.Replicas
+
+	key := "quorum.txt"
+	replicas := r.replicasOf(key)
+	replica := replicas[len(replicas)-1]
+	if replica == client {
+		t.Fatal("the client is a replica, pick another one")
+	}
+	r.kill(replica)
+
+	res, err := client.replicate(ctx, key, Item{Value: []byte("v1"), Version: Version{Clock: 1}}, nil)
+	if !errors.Is(err, errNoQuorum) {
+		t.Fatalf("write with a replica down: got %v, want errNoQuorum", err)
+	}
+	if got := len(res.Answered()); got != client.Replicas-1 {
+		t.Errorf("%d replicas answered, want %d", got, client.Replicas-1)
+	}
+	for _, rep := range res.Replicas {
+		if (rep.Err != nil) != (rep.Node.Address == replica.Address) {
+			t.Errorf("replica %s answered with %v", rep.Node.Address, rep.Err)
+		}
+	}
+
+	client.WriteQuorum = client.Replicas - 1
+	if _, err := client.replicate(ctx, key, Item{Value: []byte("v1"), Version: Version{Clock: 1}}, nil); err != nil {
+		t.Fatalf("write with enough replicas up: %v", err)
+	}
+}
+
+func TestReadQuorumReturnsNewest(t *testing.T) {
+	r := newTestRing(t, 10)
+	ctx := context.Background()
+	client := r.nodes[0]
+	client.ReadQuorum = client.Replicas
+
+	// only one replica saw the latest write
+	key := "stale.txt"
+	if _, err := client.replicate(ctx, key, Item{Value: []byte("old"), Version: Version{Clock: 1}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	replicas := r.replicasOf(key)
+	last := replicas[len(replicas)-1]
+	if last == client {
+		t.Fatal("the client is a replica, pick another one")
+	}
+	last.store(key, Item{Value: []byte("new"), Version: Version{Clock: 2}}, nil)
+
+	res, err := client.read(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Found || string(res.Item.Value) != "new" {
+		t.Errorf("read = %q (found %v), want the newest version", res.Item.Value, res.Found)
+	}
+	if got := len(res.Answered()); got != client.Replicas {
+		t.Errorf("%d replicas answered, want %d", got, client.Replicas)
+	}
+
+	// a newer delete on one replica hides the file
+	last.store(key, Item{Version: Version{Clock: 3}, Deleted: true}, nil)
+	if res, err := client.read(ctx, key); err != nil || res.Found {
+		t.Errorf("read after delete = found %v, %v; want not found", res.Found, err)
+	}
+
+	// and with too few replicas up there is no answer at all
+	r.kill(last)
+	if _, err := client.read(ctx, key); !errors.Is(err, errNoQuorum) {
+		t.Errorf("read with a replica down: got %v, want errNoQuorum", err)
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	r := newTestRing(t, 10)
+	ctx := context.Background()
+	alice, bob := r.nodes[1], r.nodes[6]
+	name := "shared.txt"
+	if _, err := alice.StoreFile(ctx, writeTestFile(t, name, []byte("v1")), "pw"); err != nil {
+		t.Fatal(err)
+	}
+	read, err := alice.Lookup(ctx, name)
+	if err != nil || !read.Found {
+		t.Fatalf("Lookup = found %v, %v", read.Found, err)
+	}
+	v1 := read.Item.Version
+
+	// bob updates the version alice read, so alice's update based on it loses
+	if _, err := bob.StoreFileIf(ctx, writeTestFile(t, name, []byte("bob")), "pw", v1); err != nil {
+		t.Fatalf("StoreFileIf with the current version: %v", err)
+	}
+	if _, err := alice.StoreFileIf(ctx, writeTestFile(t, name, []byte("alice")), "pw", v1); !errors.Is(err, errConflict) {
+		t.Fatalf("StoreFileIf with a stale version: got %v, want errConflict", err)
+	}
+	if _, err := alice.StoreFileIf(ctx, writeTestFile(t, name, []byte("alice")), "pw", Version{}); !errors.Is(err, errConflict) {
+		t.Fatalf("StoreFileIf creating an existing file: got %v, want errConflict", err)
+	}
+	got, read, err := alice.LookupFile(ctx, name, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "bob" {
+		t.Errorf("LookupFile = %q, want bob's write", got)
+	}
+	if !v1.Less(read.Item.Version) {
+		t.Errorf("version after the update is %s, want newer than %s", read.Item.Version, v1)
+	}
+
+	// re-replicating a stale copy does not bring it back
+	for _, n := range r.replicasOf(name) {
+		if err := alice.pushItem(ctx, n.Address, name, Item{Value: []byte("stale"), Version: v1}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _, err := alice.LookupFile(ctx, name, "pw"); err != nil || string(got) != "bob" {
+		t.Errorf("LookupFile after a stale push = %q, %v; want bob's write", got, err)
+	}
+
+	// deletes are conditional in the same way
+	if _, err := alice.DeleteFileIf(ctx, name, v1); !errors.Is(err, errConflict) {
+		t.Fatalf("DeleteFileIf with a stale version: got %v, want errConflict", err)
+	}
+	if _, err := alice.DeleteFileIf(ctx, name, read.Item.Version); err != nil {
+		t.Fatalf("DeleteFileIf with the current version: %v", err)
+	}
+	if res, err := bob.Lookup(ctx, name); err != nil || res.Found {
+		t.Errorf("Lookup after delete = found %v, %v; want not found", res.Found, err)
+	}
+}
+
+func TestJoinTakesOverKeys(t *testing.T) {
+	r := newTestRing(t, 10)
+	ctx := context.Background()
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("file-%02d", i)
+		if _, err := r.nodes[0].StoreFile(ctx, writeTestFile(t, name, []byte(name)), "pw"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		n := r.join(r.nodes[0].Address)
+		for i := 0; i < 40; i++ {
+			name := fmt.Sprintf("file-%02d", i)
+			if r.owner(hash(name)) != n {
+				continue
+			}
+			if _, ok, _ := n.Bucket.Get(name); !ok {
+				t.Errorf("%s joined but did not take over %s", n.Address, name)
+			}
+		}
+	}
+	r.fixFingers()
+
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("file-%02d", i)
+		got, _, err := r.nodes[3].LookupFile(ctx, name, "pw")
+		if err != nil {
+			t.Fatalf("LookupFile(%s): %v", name, err)
+		}
+		if string(got) != name {
+			t.Errorf("LookupFile(%s) = %q", name, got)
+		}
+	}
+}
+
+func TestJoinReleasesKeys(t *testing.T) {
+	r := newTestRing(t, 8)
+	ctx := context.Background()
+	for _, n := range r.nodes {
+		n.Replicas = 1
+	}
+	var names []string
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("file-%02d", i)
+		if _, err := r.nodes[0].StoreFile(ctx, writeTestFile(t, name, []byte(name)), "pw"); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	// without replicas, the keys a new node takes over have nowhere else to
+	// be: its successor lets go of them
+	for i := 0; i < 4; i++ {
+		r.join(r.nodes[0].Address).Replicas = 1
+	}
+	r.maintainReplicas()
+	r.checkReplicas(names)
+	for _, name := range names {
+		if got, _, err := r.nodes[2].LookupFile(ctx, name, "pw"); err != nil || string(got) != name {
+			t.Errorf("LookupFile(%s) = %q, %v", name, got, err)
+		}
+	}
+}
+
+// maintainReplicas runs the replication maintainer on every live node
+func (r *testRing) maintainReplicas() {
+	ctx := context.Background()
+	for _, n := range r.live() {
+		n.maintainReplicas(ctx)
+	}
+}
+
+// checkReplicas fails the test unless every key is on exactly the live
+// nodes that should hold it
+func (r *testRing) checkReplicas(keys []string) {
+	r.t.Helper()
+	for _, key := range keys {
+		want := r.replicasOf(key)
+		var got []*Node
+		for _, n := range r.live() {
+			if _, ok, _ := n.Bucket.Get(key); ok {
+				got = append(got, n)
+			}
+		}
+		slices.SortFunc(want, func(a, b *Node) int { return a.id().Cmp(b.id()) })
+		if !slices.Equal(got, want) {
+			r.t.Fatalf("%s is on %d nodes, want it on its %d replicas", key, len(got), len(want))
+		}
+	}
+}
+
+func TestReplicasRestoredAfterFailures(t *testing.T) {
+	r := newTestRing(t, 12)
+	ctx := context.Background()
+	r.maintainReplicas()
+	var names []string
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("file-%02d", i)
+		if _, err := r.nodes[0].StoreFile(ctx, writeTestFile(t, name, []byte(name)), "pw"); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	// one failure after another, each taking away a replica of some files;
+	// without re-replication the third one would lose some of them
+	for _, i := range []int{3, 7, 10, 4} {
+		r.kill(r.nodes[i])
+		r.settle()
+		r.maintainReplicas()
+		r.checkReplicas(names)
+	}
+}
+
+func TestReplicasHandedBackAfterJoin(t *testing.T) {
+	r := newTestRing(t, 8)
+	ctx := context.Background()
+	r.maintainReplicas()
+	var names []string
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("file-%02d", i)
+		if _, err := r.nodes[0].StoreFile(ctx, writeTestFile(t, name, []byte(name)), "pw"); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	// new nodes push the last replica holders of their keys out of the
+	// replica set; those only notice on their next full check
+	for i := 0; i < 4; i++ {
+		r.join(r.nodes[0].Address)
+	}
+	for _, n := range r.live() {
+		n.replicasChecked = time.Time{}
+	}
+	r.maintainReplicas()
+	r.checkReplicas(names)
+	for _, name := range names {
+		if got, _, err := r.nodes[5].LookupFile(ctx, name, "pw"); err != nil || string(got) != name {
+			t.Errorf("LookupFile(%s) = %q, %v", name, got, err)
+		}
+	}
+}
+
+func TestReplicaCheckOnlyHandsBack(t *testing.T) {
+	r := newTestRing(t, 8)
+	ctx := context.Background()
+	r.maintainReplicas()
+	var names []string
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("file-%02d", i)
+		if _, err := r.nodes[0].StoreFile(ctx, writeTestFile(t, name, []byte(name)), "pw"); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	// nothing changed: the periodic check sends no values around
+	var mu sync.Mutex
+	writes := 0
+	r.transport.setIntercept(func(_ context.Context, _, method string) error {
+		if method == "Put" || method == "PutStream" || method == "Delete" {
+			mu.Lock()
+			writes++
+			mu.Unlock()
+		}
+		return nil
+	})
+	for _, n := range r.live() {
+		n.replicasChecked = time.Time{}
+	}
+	r.maintainReplicas()
+	r.transport.setIntercept(nil)
+	if writes != 0 {
+		t.Errorf("the replica check of a settled ring made %d writes", writes)
+	}
+	r.checkReplicas(names)
+}
+
+func TestRestartedNodeReannouncesKeys(t *testing.T) {
+	r := newTestRing(t, 20)
+	ctx := context.Background()
+
+	// a node goes down with a file on disk that the rest of the ring lost,
+	// and one that was deleted while it was away
+	store, err := newFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("kept", Item{Value: []byte("kept"), Version: Version{Clock: 1}})
+	store.Put("gone", Item{Value: []byte("gone"), Version: Version{Clock: 1}})
+	if _, err := r.nodes[0].replicate(ctx, "gone", Item{Version: Version{Clock: 2}, Deleted: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// it comes back at a new address with what it had on disk
+	store, err = newFileStore(store.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := newNode("restarted:"+defaultPort, nil, testSuccessorList, store, r.transport)
+	r.transport.register(n)
+	r.nodes = append(r.nodes, n)
+	n.join(ctx, r.nodes[0].Address)
+	r.settle()
+	r.fixFingers()
+	n.announce(ctx)
+
+	owner := r.owner(hash("kept"))
+	if got, _ := owner.Get(ctx, &pb.GetRequest{Key: "kept"}); string(got.Value) != "kept" {
+		t.Errorf("owner %s has %q for the re-announced key", owner.Address, got.Value)
+	}
+	owner = r.owner(hash("gone"))
+	if got, _ := owner.Get(ctx, &pb.GetRequest{Key: "gone"}); got.Value != nil {
+		t.Errorf("re-announcing brought back a deleted key on %s", owner.Address)
+	}
+}
+
+func TestLeaveRingHandsOverKeys(t *testing.T) {
+	r := newTestRing(t, 10)
+	ctx := context.Background()
+	live := r.live()
+	pred, leaving, heir := live[3], live[4], live[5]
+
+	// keys only the leaving node holds, so the heir can only have them from
+	// the handover
+	var keys []string
+	for i := 0; len(keys) < 20; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		if r.owner(hash(key)) != leaving {
+			continue
+		}
+		if err := leaving.Bucket.Put(key, Item{Value: []byte(key), Version: Version{Clock: 1}}); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := leaving.LeaveRing(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if item, ok, _ := heir.Bucket.Get(key); !ok || string(item.Value) != key {
+			t.Errorf("%s was not handed to %s", key, heir.Address)
+		}
+	}
+	// the neighbours are linked at once, before checkPredecessor could
+	// notice that the node is gone
+	if heir.Predecessor.Address != pred.Address {
+		t.Errorf("predecessor of %s is %s, want %s", heir.Address, heir.Predecessor.Address, pred.Address)
+	}
+	if pred.Successors[0].Address != heir.Address {
+		t.Errorf("successor of %s is %s, want %s", pred.Address, pred.Successors[0].Address, heir.Address)
+	}
+	for _, succ := range pred.Successors {
+		if succ.Address == leaving.Address {
+			t.Errorf("%s still lists %s as a successor", pred.Address, leaving.Address)
+		}
+	}
+	if err := leaving.Stop(ctx); err == nil {
+		t.Errorf("%s was not stopped by LeaveRing", leaving.Address)
+	}
+}
+
+func TestLeaveOfUnrelatedNodeIsIgnored(t *testing.T) {
+	r := newTestRing(t, 10)
+	ctx := context.Background()
+	live := r.live()
+	n, stranger := live[2], live[8]
+	addresses := func(nb Neighbours) []string {
+		list := []string{nb.Predecessor.Address}
+		for _, s := range nb.Successors {
+			list = append(list, s.Address)
+		}
+		return list
+	}
+	before := addresses(n.neighbours())
+
+	// neither our predecessor nor one of our successors
+	if err := r.transport.Peer(n.Address).Leave(ctx, stranger.neighbours()); err != nil {
+		t.Fatal(err)
+	}
+	if after := addresses(n.neighbours()); !slices.Equal(after, before) {
+		t.Errorf("%s leaving changed the neighbours of %s from %v to %v", stranger.Address, n.Address, before, after)
+	}
+}
@@ -0,0 +1,341 @@
+package chord
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// how long a Client trusts what it learned about the ring
+const defaultRingCacheTTL = 10 * time.Second
+
+// ClientConfig describes how a Client reaches the ring and stores files.
+// The zero value of every field but Seeds picks the same default as for a
+// node.
+type ClientConfig struct {
+	// Seeds are nodes of the ring, asked in turn where a file belongs
+	Seeds []string
+
+	TLS      TLSFiles
+	Timeout  time.Duration
+	Timeouts map[string]time.Duration
+
+	Replicas    int
+	ReadQuorum  int
+	WriteQuorum int
+
+	// CacheTTL is how long the owner of a part of the ring is remembered
+	CacheTTL time.Duration
+
+	// ChunkSize, UploadDir, Dedup, NameKey and Identity as on Node
+	ChunkSize int
+	UploadDir string
+	Dedup     bool
+	NameKey   []byte
+	Identity  *ecdh.PrivateKey
+}
+
+// Client reads and writes files in a ring without being part of it. It
+// finds the nodes responsible for a file through the seeds, remembers
+// which part of the ring they hold, and reads from the next replica when
+// one does not answer. A Client is safe for concurrent use.
+type Client struct {
+	node *Node // outside the ring, for the way nodes store files
+	ring *ringCache
+}
+
+// NewClient sets up a client for the ring the seeds belong to. It does not
+// contact them until the first call.
+func NewClient(cfg ClientConfig) (*Client, error) {
+	if len(cfg.Seeds) == 0 {
+		return nil, errors.New("no seed to reach the ring through")
+	}
+	if cfg.TLS == (TLSFiles{}) {
+		cfg.TLS = DefaultTLSFiles
+	}
+	timeouts, err := callTimeouts(cfg.Timeout, cfg.Timeouts)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := newGRPCTransport(cfg.TLS, timeouts)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newClient(cfg, transport)
+	if err != nil {
+		transport.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient sets up a client that reaches the ring through transport
+func newClient(cfg ClientConfig, transport Transport) (*Client, error) {
+	if cfg.Replicas == 0 {
+		cfg.Replicas = defaultReplicas
+	}
+	if cfg.ReadQuorum == 0 {
+		cfg.ReadQuorum = defaultReadQuorum
+	}
+	if cfg.WriteQuorum == 0 {
+		cfg.WriteQuorum = defaultWriteQuorum
+	}
+	if cfg.ReadQuorum > cfg.Replicas || cfg.WriteQuorum > cfg.Replicas {
+		return nil, fmt.Errorf("read and write quorum must be at most the number of replicas (%d)", cfg.Replicas)
+	}
+	if err := checkChunkSize(cfg.ChunkSize); err != nil {
+		return nil, err
+	}
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = defaultRingCacheTTL
+	}
+
+	// the versions we write carry our identifier; make it our own
+	id, err := rand.Int(rand.Reader, hashMod)
+	if err != nil {
+		return nil, err
+	}
+	var seeds []string
+	for _, seed := range cfg.Seeds {
+		seeds = append(seeds, withPort(seed))
+	}
+	ring := &ringCache{transport: transport, seeds: seeds, ttl: cfg.CacheTTL}
+
+	n := newNode("", id, cfg.Replicas, nil, transport)
+	n.ring = ring
+	n.Replicas = cfg.Replicas
+	n.ReadQuorum = cfg.ReadQuorum
+	n.WriteQuorum = cfg.WriteQuorum
+	n.Dedup = cfg.Dedup
+	n.NameKey = cfg.NameKey
+	n.Identity = cfg.Identity
+	if cfg.ChunkSize != 0 {
+		n.ChunkSize = cfg.ChunkSize
+	}
+	if cfg.UploadDir != "" {
+		n.UploadDir = cfg.UploadDir
+	}
+	return &Client{node: n, ring: ring}, nil
+}
+
+// PutFile encrypts the local file and stores it under its base name, as
+// StoreFile on a node does. Storing it again after a failure resumes the
+// upload.
+func (c *Client) PutFile(ctx context.Context, localPath string, password string) (QuorumResult, error) {
+	res, err := c.node.StoreFile(ctx, localPath, password)
+	return res, c.check(err)
+}
+
+// Put encrypts what r yields and stores it as the file name
+func (c *Client) Put(ctx context.Context, name string, r io.Reader, password string) (QuorumResult, error) {
+	res, err := c.node.StoreReader(ctx, name, r, password)
+	return res, c.check(err)
+}
+
+// Get decrypts the file name into w, with the password or, for a file
+// shared with us, our Identity. The result says whether it was found.
+func (c *Client) Get(ctx context.Context, name string, password string, w io.Writer) (ReadResult, error) {
+	res, err := c.node.FetchFile(ctx, name, password, w)
+	return res, c.check(err)
+}
+
+// Delete deletes the file name
+func (c *Client) Delete(ctx context.Context, name string) (QuorumResult, error) {
+	res, err := c.node.DeleteFile(ctx, name)
+	return res, c.check(err)
+}
+
+// FileInfo is what List tells about a file without opening it
+type FileInfo struct {
+	Name    string // as stored, so a keyed hash of the name with a NameKey
+	Size    int64  // -1 if only the password tells
+	Version Version
+	Owner   NodeRef
+}
+
+// List returns the files stored in the ring, as the nodes responsible for
+// them have them, sorted by name
+func (c *Client) List(ctx context.Context) ([]FileInfo, error) {
+	ring, err := c.ring.walk(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var files []FileInfo
+	for i, ref := range ring {
+		pred := ring[(i+len(ring)-1)%len(ring)]
+		keys, err := c.node.peer(ref.Address).ListKeys(ctx, pred.Identifier, ref.Identifier, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the files on %s: %v", ref.Address, err)
+		}
+		for _, k := range keys {
+			if !k.Deleted {
+				files = append(files, FileInfo{Name: k.Key, Size: k.Size, Version: k.Version, Owner: ref})
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// Ring walks the ring from the first seed that answers and returns its
+// nodes in order
+func (c *Client) Ring(ctx context.Context) ([]NodeRef, error) {
+	return c.ring.walk(ctx)
+}
+
+// Close closes the connections to the ring
+func (c *Client) Close() error {
+	return c.node.transport.Close()
+}
+
+// check forgets what we know about the ring after a failure, so that the
+// next call finds the nodes responsible anew
+func (c *Client) check(err error) error {
+	if err != nil {
+		c.ring.flush()
+	}
+	return err
+}
+
+// ringCache remembers which node is responsible for which part of the
+// ring, as the owner and its neighbours
+type ringCache struct {
+	transport Transport
+	seeds     []string
+	ttl       time.Duration
+
+	mu     sync.Mutex
+	owners []cachedOwner
+}
+
+type cachedOwner struct {
+	nb      Neighbours // the owner of (nb.Predecessor, nb.Self]
+	expires time.Time
+}
+
+// find returns the node responsible for id with its neighbours, from the
+// cache or by asking the seeds and then the nodes we know, in turn
+func (c *ringCache) find(ctx context.Context, id *big.Int) (Neighbours, error) {
+	c.mu.Lock()
+	now := time.Now()
+	var contacts []string
+	for _, o := range c.owners {
+		if now.Before(o.expires) && between(o.nb.Predecessor.Identifier, id, o.nb.Self.Identifier, true) {
+			c.mu.Unlock()
+			return o.nb, nil
+		}
+		contacts = append(contacts, o.nb.Self.Address)
+	}
+	c.mu.Unlock()
+
+	err := errors.New("no node to ask")
+	for _, address := range append(append([]string(nil), c.seeds...), contacts...) {
+		var owner NodeRef
+		owner, err = c.transport.Peer(address).FindSuccessor(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		nb, err := c.transport.Peer(owner.Address).GetPredecessor(ctx)
+		if err != nil {
+			return Neighbours{Self: owner}, fmt.Errorf("failed to get successors of %s: %v", owner.Address, err)
+		}
+		c.add(nb)
+		return nb, nil
+	}
+	return Neighbours{}, fmt.Errorf("failed to lookup node for key: %v", err)
+}
+
+// add remembers the part of the ring nb is responsible for, and forgets
+// whatever overlaps it
+func (c *ringCache) add(nb Neighbours) {
+	// without a predecessor the owner does not know where its part starts
+	if nb.Predecessor.IsZero() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	kept := c.owners[:0]
+	for _, o := range c.owners {
+		if now.After(o.expires) || o.nb.Self.Address == nb.Self.Address ||
+			between(o.nb.Predecessor.Identifier, nb.Self.Identifier, o.nb.Self.Identifier, true) ||
+			between(nb.Predecessor.Identifier, o.nb.Self.Identifier, nb.Self.Identifier, true) {
+			continue
+		}
+		kept = append(kept, o)
+	}
+	c.owners = append(kept, cachedOwner{nb: nb, expires: now.Add(c.ttl)})
+}
+
+// flush forgets everything we know about the ring
+func (c *ringCache) flush() {
+	c.mu.Lock()
+	c.owners = nil
+	c.mu.Unlock()
+}
+
+// walk follows the ring from the first seed that answers, remembering
+// what every node is responsible for on the way
+func (c *ringCache) walk(ctx context.Context) ([]NodeRef, error) {
+	return walkRing(ctx, c.transport, c.seeds, c.add)
+}
+
+// walkRing follows the successors from the first of seeds that answers
+// until it is back where it started, and returns the nodes in ring order.
+// visit, if not nil, sees the neighbours of every node.
+func walkRing(ctx context.Context, transport Transport, seeds []string, visit func(Neighbours)) ([]NodeRef, error) {
+	var nb Neighbours
+	err := errors.New("no seed")
+	for _, seed := range seeds {
+		if nb, err = transport.Peer(seed).GetPredecessor(ctx); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no seed answered: %v", err)
+	}
+	start := nb.Self
+	ring := []NodeRef{start}
+	seen := map[string]bool{start.Address: true}
+	for len(ring) <= 1<<16 {
+		if visit != nil {
+			visit(nb)
+		}
+		// the first successor that answers is the next node
+		var next Neighbours
+		err = errors.New("no successor")
+		for _, succ := range nb.Successors {
+			if succ.IsZero() {
+				continue
+			}
+			if seen[succ.Address] {
+				err = nil
+				next = Neighbours{}
+				break
+			}
+			if next, err = transport.Peer(succ.Address).GetPredecessor(ctx); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return ring, fmt.Errorf("ring is broken after %s: %v", nb.Self.Address, err)
+		}
+		if next.Self.IsZero() {
+			return ring, nil
+		}
+		ring = append(ring, next.Self)
+		seen[next.Self.Address] = true
+		nb = next
+	}
+	return ring, nil
+}
@@ -0,0 +1,115 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestClientStoresAndReadsFiles(t *testing.T) {
+	r := newTestRing(t, testRingSize)
+	ctx := context.Background()
+	c, err := newClient(ClientConfig{Seeds: []string{r.nodes[0].Address}, UploadDir: t.TempDir()}, r.transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := randomData(1, 3*defaultChunkSize+17)
+	res, err := c.Put(ctx, "batch.bin", bytes.NewReader(data), "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := r.owner(hash("batch.bin")); res.Owner.Address != owner.Address {
+		t.Errorf("Put went to owner %s, want %s", res.Owner.Address, owner.Address)
+	}
+
+	// what the client stored, any node reads, and the other way around
+	got, _, err := r.nodes[20].LookupFile(ctx, "batch.bin", "pw")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("LookupFile of what the client stored: %d bytes, %v", len(got), err)
+	}
+	if _, err := r.nodes[20].StoreFile(ctx, writeTestFile(t, "node.txt", []byte("from a node")), "pw"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if lookup, err := c.Get(ctx, "node.txt", "pw", &buf); err != nil || !lookup.Found || buf.String() != "from a node" {
+		t.Fatalf("Get = %q, found %v, %v", buf.String(), lookup.Found, err)
+	}
+
+	// the owner fails, and the replicas the client knows of answer in its
+	// place before the ring even noticed
+	r.kill(r.owner(hash("batch.bin")))
+	buf.Reset()
+	if _, err := c.Get(ctx, "batch.bin", "pw", &buf); err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("Get with the owner down: %d bytes, %v", buf.Len(), err)
+	}
+
+	r.settle()
+	if _, err := c.Delete(ctx, "node.txt"); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if lookup, err := c.Get(ctx, "node.txt", "pw", &buf); err != nil || lookup.Found {
+		t.Fatalf("Get after Delete: found %v, %v", lookup.Found, err)
+	}
+}
+
+func TestClientWalksRing(t *testing.T) {
+	r := newTestRing(t, 10)
+	c, err := newClient(ClientConfig{Seeds: []string{"nowhere:1", r.nodes[3].Address}}, r.transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := c.Ring(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := r.live()
+	if len(ring) != len(live) {
+		t.Fatalf("walked %d nodes, want %d", len(ring), len(live))
+	}
+	// in ring order, from the seed that answered
+	start := 0
+	for live[start] != r.nodes[3] {
+		start++
+	}
+	for i, ref := range ring {
+		if want := live[(start+i)%len(live)]; ref.Address != want.Address {
+			t.Errorf("node %d of the ring is %s, want %s", i, ref.Address, want.Address)
+		}
+	}
+}
+
+func TestClientListsFiles(t *testing.T) {
+	r := newTestRing(t, 10)
+	ctx := context.Background()
+	c, err := newClient(ClientConfig{Seeds: []string{r.nodes[0].Address}}, r.transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.txt", "a.txt", "gone.txt"} {
+		if _, err := c.Put(ctx, name, bytes.NewReader([]byte(name)), "pw"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Delete(ctx, "gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// every file once, without its chunks or the deleted one
+	files, err := c.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != "a.txt" || files[1].Name != "b.txt" {
+		t.Fatalf("List = %+v, want a.txt and b.txt", files)
+	}
+	for _, f := range files {
+		if f.Size != int64(len(f.Name)) {
+			t.Errorf("%s has size %d, want %d", f.Name, f.Size, len(f.Name))
+		}
+		if owner := r.owner(hash(f.Name)); f.Owner.Address != owner.Address {
+			t.Errorf("%s is listed on %s, want %s", f.Name, f.Owner.Address, owner.Address)
+		}
+	}
+}
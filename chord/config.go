@@ -0,0 +1,382 @@
+package chord
+
+import (
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// how often stabilize, fix fingers and check predecessor run by default
+	defaultInterval          = time.Second / 3
+	defaultSuccessorListSize = 20
+
+	// how long a new node waits for stabilize to find its place in the
+	// ring before fixing fingers and re-announcing its keys
+	settleDelay = 2 * time.Second
+)
+
+// Config describes a node to be started with New. The zero value of every
+// field but Address picks a default.
+type Config struct {
+	// Address is where the node listens, as host:port; without a port it
+	// listens on 3410
+	Address string
+	// AdvertiseAddress is where other nodes reach us, if that is not
+	// Address, e.g. behind NAT or when listening on all interfaces. Its
+	// hash is our place in the ring unless Identifier is set.
+	AdvertiseAddress string
+	// Join lists nodes of an existing ring, tried in turn. Without any the
+	// node creates a ring of its own.
+	Join []string
+
+	StabilizeInterval        time.Duration
+	FixFingersInterval       time.Duration
+	CheckPredecessorInterval time.Duration
+	AntiEntropyInterval      time.Duration
+
+	// SuccessorListSize is how many successors we keep track of, 20 by
+	// default
+	SuccessorListSize int
+	// Identifier overrides our place in the ring. With mutual TLS it must
+	// match the certificate, which gives the identifier otherwise.
+	Identifier *big.Int
+
+	// TLS says where our certificates are, DefaultTLSFiles if unset
+	TLS TLSFiles
+	// Timeout is how long we wait for another node to answer any method;
+	// Timeouts overrides it for single methods
+	Timeout  time.Duration
+	Timeouts map[string]time.Duration
+
+	// Store holds our items, in memory if nil. The node closes it on Stop.
+	Store Store
+
+	// Replicas, ReadQuorum and WriteQuorum as on Node
+	Replicas    int
+	ReadQuorum  int
+	WriteQuorum int
+
+	// ChunkSize, UploadDir, Dedup, NameKey and Identity as on Node, for
+	// the files this node stores and looks up itself
+	ChunkSize int
+	UploadDir string
+	Dedup     bool
+	NameKey   []byte
+	Identity  *ecdh.PrivateKey
+
+	// HTTPAddress, if set, is where the node serves Handler, as host:port.
+	// The gateway is plain HTTP and checks no caller, TLS and MutualTLS
+	// do not apply to it: anyone who reaches it sees the ring, creates
+	// files, and reads, overwrites or deletes a file whose password they
+	// send. Listen on a trusted network, or behind a proxy that
+	// authenticates and encrypts.
+	HTTPAddress string
+}
+
+// withPort adds the default port to an address without one
+func withPort(address string) string {
+	if _, _, err := net.SplitHostPort(address); err != nil && address != "" {
+		return net.JoinHostPort(address, defaultPort)
+	}
+	return address
+}
+
+// New sets up a node as described by cfg. It does not listen or contact
+// other nodes until Start.
+func New(cfg Config) (*Node, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("no address to listen on")
+	}
+	cfg.Address = withPort(cfg.Address)
+	cfg.AdvertiseAddress = withPort(cfg.AdvertiseAddress)
+	if cfg.AdvertiseAddress == "" {
+		cfg.AdvertiseAddress = cfg.Address
+	}
+	seeds := cfg.Join
+	cfg.Join = nil
+	for _, seed := range seeds {
+		cfg.Join = append(cfg.Join, withPort(seed))
+	}
+
+	if cfg.StabilizeInterval == 0 {
+		cfg.StabilizeInterval = defaultInterval
+	}
+	if cfg.FixFingersInterval == 0 {
+		cfg.FixFingersInterval = defaultInterval
+	}
+	if cfg.CheckPredecessorInterval == 0 {
+		cfg.CheckPredecessorInterval = defaultInterval
+	}
+	if cfg.AntiEntropyInterval == 0 {
+		cfg.AntiEntropyInterval = defaultAntiEntropyInterval
+	}
+	if cfg.SuccessorListSize == 0 {
+		cfg.SuccessorListSize = defaultSuccessorListSize
+	}
+	if cfg.SuccessorListSize < 1 {
+		return nil, fmt.Errorf("successor list size must be at least 1, not %d", cfg.SuccessorListSize)
+	}
+
+	// replicas are the owner and the start of its successor list
+	if cfg.Replicas == 0 {
+		cfg.Replicas = min(defaultReplicas, cfg.SuccessorListSize+1)
+	}
+	if cfg.ReadQuorum == 0 {
+		cfg.ReadQuorum = defaultReadQuorum
+	}
+	if cfg.WriteQuorum == 0 {
+		cfg.WriteQuorum = defaultWriteQuorum
+	}
+	if cfg.Replicas > cfg.SuccessorListSize+1 {
+		return nil, fmt.Errorf("replicas must be at most one more than the successor list size (%d)", cfg.SuccessorListSize)
+	}
+	if cfg.ReadQuorum > cfg.Replicas || cfg.WriteQuorum > cfg.Replicas {
+		return nil, fmt.Errorf("read and write quorum must be at most the number of replicas (%d)", cfg.Replicas)
+	}
+	if err := checkChunkSize(cfg.ChunkSize); err != nil {
+		return nil, err
+	}
+
+	if cfg.TLS == (TLSFiles{}) {
+		cfg.TLS = DefaultTLSFiles
+	}
+	// With mutual TLS our place in the ring comes with our certificate
+	id := cfg.Identifier
+	if cfg.TLS.Mutual {
+		certID, err := cfg.TLS.identifier()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read node certificate: %v", err)
+		}
+		if id != nil && id.Cmp(certID) != 0 {
+			return nil, fmt.Errorf("identifier %040x does not match the certificate, which is for %040x", id, certID)
+		}
+		id = certID
+	}
+
+	timeouts, err := callTimeouts(cfg.Timeout, cfg.Timeouts)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := cfg.TLS.serverCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS credentials: %v", err)
+	}
+	// Connections to other nodes are dialed lazily and reused
+	transport, err := newGRPCTransport(cfg.TLS, timeouts)
+	if err != nil {
+		return nil, err
+	}
+	store := cfg.Store
+	if store == nil {
+		store = newMemStore()
+	}
+
+	n := newNode(cfg.AdvertiseAddress, id, cfg.SuccessorListSize, store, transport)
+	n.Replicas = cfg.Replicas
+	n.ReadQuorum = cfg.ReadQuorum
+	n.WriteQuorum = cfg.WriteQuorum
+	n.Dedup = cfg.Dedup
+	n.NameKey = cfg.NameKey
+	n.Identity = cfg.Identity
+	if cfg.ChunkSize != 0 {
+		n.ChunkSize = cfg.ChunkSize
+	}
+	if cfg.UploadDir != "" {
+		n.UploadDir = cfg.UploadDir
+	}
+	n.verifyCallers = cfg.TLS.Mutual
+	n.config = cfg
+	n.server = grpc.NewServer(grpc.Creds(creds))
+	pb.RegisterChordServer(n.server, n)
+	return n, nil
+}
+
+// Start listens for other nodes, creates a ring or joins one through the
+// first seed that answers, and starts the maintenance that keeps the ring
+// and our replicas in shape until Stop. ctx only bounds joining. If Start
+// fails, the node is stopped as by Stop, and cannot be started again.
+func (n *Node) Start(ctx context.Context) error {
+	if n.server == nil {
+		return errors.New("node was not set up with New")
+	}
+	if err := n.start(ctx); err != nil {
+		// nothing runs yet that would need time to wind down
+		n.Stop(context.Background())
+		return err
+	}
+	return nil
+}
+
+func (n *Node) start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", n.config.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+	// listening on port 0 leaves the port to the system; that is the one
+	// others have to use, too
+	if _, port, _ := net.SplitHostPort(n.Address); port == "0" && n.config.AdvertiseAddress == n.config.Address {
+		n.Address = lis.Addr().String()
+	}
+
+	log.Printf("Starting Chord node server on %s", n.Address)
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		if err := n.server.Serve(lis); err != nil {
+			log.Printf("failed to serve: %v", err)
+		}
+	}()
+
+	if len(n.config.Join) == 0 {
+		log.Print("Start: creating new ring")
+		n.create()
+	} else if err := n.joinAny(ctx, n.config.Join); err != nil {
+		n.server.Stop()
+		<-served
+		return err
+	}
+
+	if n.config.HTTPAddress != "" {
+		if err := n.serveHTTP(); err != nil {
+			n.server.Stop()
+			<-served
+			return err
+		}
+	}
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+	n.every(loopCtx, 0, n.config.StabilizeInterval, n.stabilize)
+	// in its own loop, so that copying keys around does not hold up
+	// stabilize
+	n.every(loopCtx, 0, n.config.StabilizeInterval, n.maintainReplicas)
+	n.every(loopCtx, 0, n.config.CheckPredecessorInterval, n.checkPredecessor)
+	n.every(loopCtx, 0, n.config.AntiEntropyInterval, n.antiEntropy)
+	nextFinger := 0
+	n.every(loopCtx, settleDelay, n.config.FixFingersInterval, func(ctx context.Context) {
+		nextFinger = n.fixFingers(ctx, nextFinger)
+	})
+	// hand back whatever we kept from an earlier run, once stabilize has
+	// had a chance to find our place in the ring
+	n.every(loopCtx, settleDelay, 0, n.announce)
+	return nil
+}
+
+// joinAny joins the ring through the first of seeds that lets us in
+func (n *Node) joinAny(ctx context.Context, seeds []string) error {
+	var err error
+	for _, seed := range seeds {
+		log.Print("Start: joining existing ring using ", seed)
+		if err = n.join(ctx, seed); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to join the ring: %v", err)
+}
+
+// every runs f after delay and then every interval, or just once if
+// interval is zero, until ctx is done
+func (n *Node) every(ctx context.Context, delay, interval time.Duration, f func(context.Context)) {
+	n.loops.Add(1)
+	go func() {
+		defer n.loops.Done()
+		wait := delay
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			f(ctx)
+			if interval == 0 {
+				return
+			}
+			wait = interval
+		}
+	}()
+}
+
+// serveHTTP serves the HTTP gateway on config.HTTPAddress until Stop
+func (n *Node) serveHTTP() error {
+	lis, err := net.Listen("tcp", n.config.HTTPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen for HTTP: %v", err)
+	}
+	n.httpAddr = lis.Addr()
+	n.httpServer = &http.Server{Handler: n.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Serving HTTP on %s", lis.Addr())
+	go func() {
+		if err := n.httpServer.Serve(lis); err != http.ErrServerClosed {
+			log.Printf("failed to serve HTTP: %v", err)
+		}
+	}()
+	return nil
+}
+
+// HTTPAddress returns where the HTTP gateway listens, or "" if it does not
+func (n *Node) HTTPAddress() string {
+	if n.httpAddr == nil {
+		return ""
+	}
+	return n.httpAddr.String()
+}
+
+// Stop stops the maintenance goroutines, the gRPC and HTTP servers, closes
+// our connections to other nodes and our store. Calls in progress may finish
+// until ctx is done. Stop does not hand our keys to anyone, see LeaveRing.
+func (n *Node) Stop(ctx context.Context) error {
+	err := errors.New("node already stopped")
+	n.stopOnce.Do(func() {
+		err = n.stop(ctx)
+	})
+	return err
+}
+
+func (n *Node) stop(ctx context.Context) error {
+	if n.cancel != nil {
+		n.cancel()
+	}
+	var err error
+	if n.httpServer != nil {
+		if herr := n.httpServer.Shutdown(ctx); herr != nil {
+			n.httpServer.Close()
+			err = herr
+		}
+	}
+	if n.server != nil {
+		stopped := make(chan struct{})
+		go func() {
+			n.server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			n.server.Stop()
+			<-stopped
+			err = ctx.Err()
+		}
+	}
+	n.loops.Wait()
+	if n.transport != nil {
+		n.transport.Close()
+	}
+	if n.Bucket != nil {
+		if cerr := n.Bucket.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("closing store: %v", cerr)
+		}
+	}
+	return err
+}
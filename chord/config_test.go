@@ -0,0 +1,123 @@
+package chord
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// startNode starts a node on a free local port with fast maintenance
+func startNode(t *testing.T, files TLSFiles, join ...string) *Node {
+	t.Helper()
+	n, err := New(Config{
+		Address:                  "127.0.0.1:0",
+		Join:                     join,
+		StabilizeInterval:        20 * time.Millisecond,
+		FixFingersInterval:       20 * time.Millisecond,
+		CheckPredecessorInterval: 20 * time.Millisecond,
+		SuccessorListSize:        testSuccessorList,
+		TLS:                      files,
+		UploadDir:                t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestStartAndStop(t *testing.T) {
+	ca := newTestCA(t)
+	ctx := context.Background()
+	first := startNode(t, ca.issue("first"))
+	second := startNode(t, ca.issue("second"), first.Address)
+
+	// the maintenance loops link the two nodes up
+	deadline := time.Now().Add(5 * time.Second)
+	linked := func(a, b *Node) bool {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		return a.Predecessor.Address == b.Address && a.Successors[0].Address == b.Address
+	}
+	for !linked(first, second) || !linked(second, first) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s and %s never linked up", first.Address, second.Address)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := first.StoreFile(ctx, writeTestFile(t, "ring.txt", []byte("both")), "pw"); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := second.LookupFile(ctx, "ring.txt", "pw")
+	if err != nil || string(got) != "both" {
+		t.Fatalf("LookupFile on the other node: %q, %v", got, err)
+	}
+
+	if err := second.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Stop(ctx); err == nil {
+		t.Error("stopping twice succeeded")
+	}
+	// nobody answers at the old address any more
+	if err := first.peer(second.Address).Ping(ctx); err == nil {
+		t.Errorf("%s still answers after Stop", second.Address)
+	}
+	if err := first.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartFailsWithoutSeeds(t *testing.T) {
+	ca := newTestCA(t)
+	n, err := New(Config{Address: "127.0.0.1:0", Join: []string{"127.0.0.1:1"}, TLS: ca.issue("lonely")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Start(context.Background()); err == nil {
+		t.Fatal("Start succeeded without any seed to join")
+	}
+	// the failed Start let go of everything New set up
+	select {
+	case <-n.transport.(*grpcTransport).conns.done:
+	default:
+		t.Error("connections to other nodes are still open")
+	}
+	if err := n.Stop(context.Background()); err == nil {
+		t.Error("Stop after a failed Start succeeded, want the node already stopped")
+	}
+}
+
+func TestNewRejectsLargeChunkSize(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := Config{Address: "127.0.0.1:0", TLS: ca.issue("chunks"), ChunkSize: maxChunkSize + 1}
+	if _, err := New(cfg); err == nil {
+		t.Fatal("New accepted chunks too large for a quorum read")
+	}
+	if _, err := NewClient(ClientConfig{Seeds: []string{"127.0.0.1:1"}, TLS: cfg.TLS, ChunkSize: -1}); err == nil {
+		t.Fatal("NewClient accepted a negative chunk size")
+	}
+	cfg.ChunkSize = maxChunkSize
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Stop(context.Background())
+}
+
+func TestNewRejectsUnknownTimeout(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := Config{Address: "127.0.0.1:0", TLS: ca.issue("typo"), Timeouts: map[string]time.Duration{"FindSucessor": time.Second}}
+	if _, err := New(cfg); err == nil {
+		t.Fatal("New accepted a timeout for a method that does not exist")
+	}
+	cfg.Timeouts = map[string]time.Duration{"FindSuccessor": time.Second}
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Stop(context.Background())
+}
@@ -0,0 +1,274 @@
+package chord
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Files are encrypted with AES-GCM under a key derived from the password
+// with Argon2id, which is slow and needs a lot of memory, so that a node
+// holding a blob cannot try passwords quickly. Every blob starts with a
+// header holding the salt and the cost of the derivation, so the cost can
+// be raised without breaking old blobs. The header and the name the blob
+// is stored under are authenticated with it: a blob copied under another
+// name does not decrypt. Blobs from before the header, keyed with a plain
+// SHA-256 of the password, can still be decrypted.
+//
+// A file that can be shared is encrypted with a random data key instead,
+// see envelope. Blobs encrypted with a data key have a header without salt.
+
+// errDecrypt is wrapped into the error of a blob that does not open with
+// the key we have, usually because the password is wrong
+var errDecrypt = errors.New("failed to decrypt")
+
+const (
+	blobMagic = "chord-enc"
+	// the versions of the header: with a key derived from a password, or
+	// with a data key
+	blobPassword = 1
+	blobDataKey  = 2
+	saltSize     = 16
+	// magic, version, time, memory, threads and salt
+	blobHeaderSize = len(blobMagic) + 1 + 4 + 4 + 1 + saltSize
+	dataKeySize    = 32
+
+	// the most a header may make us spend on deriving its key
+	maxKDFTime   = 16
+	maxKDFMemory = 1 << 20 // KiB
+)
+
+// kdfParams is the cost of deriving a key with Argon2id
+type kdfParams struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+}
+
+// defaultKDF is the cost of the keys new blobs are encrypted with, the
+// second recommendation of RFC 9106
+var defaultKDF = kdfParams{Time: 3, Memory: 64 << 10, Threads: 4}
+
+// keyring encrypts and decrypts blobs with one password. Deriving a key is
+// slow on purpose, so it derives the key for each salt only once: all the
+// blobs it encrypts share a salt, and the chunks of a file are usually
+// encrypted by the same keyring.
+type keyring struct {
+	password string
+	params   kdfParams
+	// a data key to use instead of the password, see newDataKeyring
+	key []byte
+
+	mu   sync.Mutex
+	salt []byte                 // of the blobs we encrypt, chosen on first use
+	gcms map[string]cipher.AEAD // by header
+}
+
+func newKeyring(password string) *keyring {
+	return &keyring{password: password, params: defaultKDF, gcms: make(map[string]cipher.AEAD)}
+}
+
+// newDataKeyring returns a keyring that encrypts with a data key
+func newDataKeyring(key []byte) *keyring {
+	return &keyring{key: key, gcms: make(map[string]cipher.AEAD)}
+}
+
+// newDataKey returns a random data key
+func newDataKey() ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	return key, nil
+}
+
+// gcm returns the cipher for blobs with the given header
+func (k *keyring) gcm(header []byte) (cipher.AEAD, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if gcm, ok := k.gcms[string(header)]; ok {
+		return gcm, nil
+	}
+	key := k.key
+	if header[len(blobMagic)] == blobPassword {
+		p, salt := decodeBlobHeader(header)
+		key = argon2.IDKey([]byte(k.password), salt, p.Time, p.Memory, p.Threads, 32)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	k.gcms[string(header)] = gcm
+	return gcm, nil
+}
+
+// seal encrypts data to be stored under name
+func (k *keyring) seal(data []byte, name string) ([]byte, error) {
+	k.mu.Lock()
+	var header []byte
+	if k.key != nil {
+		header = append([]byte(blobMagic), blobDataKey)
+	} else if k.salt == nil {
+		salt := make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			k.mu.Unlock()
+			return nil, fmt.Errorf("failed to generate salt: %v", err)
+		}
+		k.salt = salt
+	}
+	if header == nil {
+		header = encodeBlobHeader(k.params, k.salt)
+	}
+	k.mu.Unlock()
+
+	gcm, err := k.gcm(header)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	// header, nonce, then the ciphertext
+	blob := append(append([]byte{}, header...), nonce...)
+	return gcm.Seal(blob, nonce, data, blobAAD(header, name)), nil
+}
+
+// open decrypts a blob stored under name
+func (k *keyring) open(data []byte, name string) ([]byte, error) {
+	if k.key != nil {
+		return k.openBlob(data, name)
+	}
+	if !bytes.HasPrefix(data, []byte(blobMagic)) {
+		return decryptLegacy(data, k.password)
+	}
+	plaintext, err := k.openBlob(data, name)
+	if err != nil {
+		// the nonce of an old blob may start like a header by chance
+		if plaintext, lerr := decryptLegacy(data, k.password); lerr == nil {
+			return plaintext, nil
+		}
+	}
+	return plaintext, err
+}
+
+func (k *keyring) openBlob(data []byte, name string) ([]byte, error) {
+	if len(data) <= len(blobMagic) || !bytes.HasPrefix(data, []byte(blobMagic)) {
+		return nil, fmt.Errorf("not an encrypted blob")
+	}
+	var header []byte
+	switch v := data[len(blobMagic)]; {
+	case v == blobPassword && k.key == nil:
+		if len(data) < blobHeaderSize {
+			return nil, fmt.Errorf("ciphertext too short")
+		}
+		header = data[:blobHeaderSize]
+		// do not let a blob make us derive keys forever
+		p, _ := decodeBlobHeader(header)
+		if p.Time < 1 || p.Time > maxKDFTime || p.Memory > maxKDFMemory || p.Threads < 1 {
+			return nil, fmt.Errorf("unsupported key derivation: time %d, memory %d KiB, threads %d", p.Time, p.Memory, p.Threads)
+		}
+	case v == blobDataKey && k.key != nil:
+		header = data[:len(blobMagic)+1]
+	case v == blobPassword || v == blobDataKey:
+		return nil, fmt.Errorf("%w: wrong kind of key", errDecrypt)
+	default:
+		return nil, fmt.Errorf("unsupported ciphertext version %d", v)
+	}
+	gcm, err := k.gcm(header)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(header):]
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, blobAAD(header, name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecrypt, err)
+	}
+	return plaintext, nil
+}
+
+func encodeBlobHeader(p kdfParams, salt []byte) []byte {
+	header := make([]byte, 0, blobHeaderSize)
+	header = append(header, blobMagic...)
+	header = append(header, blobPassword)
+	header = binary.BigEndian.AppendUint32(header, p.Time)
+	header = binary.BigEndian.AppendUint32(header, p.Memory)
+	header = append(header, p.Threads)
+	return append(header, salt...)
+}
+
+func decodeBlobHeader(header []byte) (kdfParams, []byte) {
+	b := header[len(blobMagic)+1:]
+	p := kdfParams{
+		Time:    binary.BigEndian.Uint32(b[0:4]),
+		Memory:  binary.BigEndian.Uint32(b[4:8]),
+		Threads: b[8],
+	}
+	return p, b[9 : 9+saltSize]
+}
+
+// blobAAD is what a blob is authenticated with besides its content
+func blobAAD(header []byte, name string) []byte {
+	return append(append([]byte{}, header...), name...)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %v", err)
+	}
+	return gcm, nil
+}
+
+// decryptLegacy decrypts a blob from before the header: the nonce and the
+// ciphertext, under the SHA-256 of the password
+func decryptLegacy(data []byte, password string) ([]byte, error) {
+	// Derive the same key from the password
+	key := sha256.Sum256([]byte(password))
+
+	// Create AES cipher block
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+
+	// Create GCM mode
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %v", err)
+	}
+
+	// Check if data is long enough to contain nonce
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	// Extract nonce and ciphertext
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+
+	// Decrypt the data
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecrypt, err)
+	}
+
+	return plaintext, nil
+}
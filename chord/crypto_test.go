@@ -0,0 +1,67 @@
+package chord
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+func TestBlobsAreBoundToNameAndPassword(t *testing.T) {
+	data := []byte("the contents of a.txt")
+	blob, err := newKeyring("pw").seal(data, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := newKeyring("pw").open(blob, "a.txt"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("open = %q, %v; want %q", got, err, data)
+	}
+	if _, err := newKeyring("pw").open(blob, "b.txt"); err == nil {
+		t.Errorf("a blob stored as a.txt decrypted as b.txt")
+	}
+	if _, err := newKeyring("wrong").open(blob, "a.txt"); err == nil {
+		t.Errorf("a blob decrypted with the wrong password")
+	}
+
+	// the header says how the key was derived, not the current default
+	p, _ := decodeBlobHeader(blob[:blobHeaderSize])
+	if p != defaultKDF {
+		t.Errorf("header has %+v, want %+v", p, defaultKDF)
+	}
+	defer func(old kdfParams) { defaultKDF = old }(defaultKDF)
+	defaultKDF.Time++
+	if got, err := newKeyring("pw").open(blob, "a.txt"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("open after raising the cost = %q, %v", got, err)
+	}
+
+	// nor may it ask for more than we are willing to spend
+	greedy := bytes.Clone(blob)
+	binary.BigEndian.PutUint32(greedy[len(blobMagic)+5:], maxKDFMemory+1)
+	if _, err := newKeyring("pw").open(greedy, "a.txt"); err == nil {
+		t.Errorf("a blob asking for %d KiB decrypted", maxKDFMemory+1)
+	}
+}
+
+func TestLegacyBlobsDecrypt(t *testing.T) {
+	// the nonce and the ciphertext, keyed with SHA-256 of the password
+	key := sha256.Sum256([]byte("pw"))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	blob := gcm.Seal(nonce, nonce, []byte("old file"), nil)
+
+	if got, err := newKeyring("pw").open(blob, "old.txt"); err != nil || string(got) != "old file" {
+		t.Fatalf("open = %q, %v; want the old file", got, err)
+	}
+	if _, err := newKeyring("wrong").open(blob, "old.txt"); err == nil {
+		t.Errorf("a legacy blob decrypted with the wrong password")
+	}
+}
@@ -0,0 +1,180 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	indexMagic       = "chord-index 1\n"
+	contentKeyPrefix = "content/"
+)
+
+// In content-addressed mode identical data is stored once. Chunks are
+// encrypted with convergent encryption: the key is the hash of the chunk,
+// so the same chunk always encrypts to the same ciphertext and ends up
+// under the same key, whoever stores it. The manifest, which holds the
+// keys of the chunks, is stored the same way under contentKeyPrefix and
+// the hash of its ciphertext. The envelope under the file name only holds
+// an index record with the content key and the key of the manifest.
+//
+// Content is shared, so it is never deleted; deleting or replacing a file
+// only changes its index record.
+
+// convergentEncrypt encrypts data under a key derived from data itself.
+// The nonce is fixed: a key only ever encrypts the one plaintext it was
+// derived from, so no nonce is used twice with different data.
+func convergentEncrypt(data []byte) (ciphertext []byte, key []byte, err error) {
+	sum := sha256.Sum256(data)
+	gcm, err := newGCM(sum[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	return gcm.Seal(nil, nonce, data, nil), sum[:], nil
+}
+
+func convergentDecrypt(ciphertext []byte, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	data, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %v", err)
+	}
+	return data, nil
+}
+
+// contentRef points at a manifest stored by content: its key, and the key
+// it is encrypted with. Its string form, key:secret, lets anybody who has
+// it read the file without knowing its name or password.
+type contentRef struct {
+	Content string `json:"content"`
+	Secret  string `json:"secret"`
+}
+
+func (r contentRef) String() string {
+	return r.Content + ":" + r.Secret
+}
+
+// parseContentRef reads the string form of a contentRef
+func parseContentRef(s string) (contentRef, bool) {
+	content, secret, found := strings.Cut(s, ":")
+	if !found || !strings.HasPrefix(content, contentKeyPrefix) {
+		return contentRef{}, false
+	}
+	return contentRef{Content: content, Secret: secret}, true
+}
+
+// parseIndex reads the index record of a file stored by content
+func parseIndex(record []byte) (contentRef, error) {
+	data, ok := bytes.CutPrefix(record, []byte(indexMagic))
+	if !ok {
+		return contentRef{}, errors.New("invalid index record")
+	}
+	var ref contentRef
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return contentRef{}, fmt.Errorf("invalid index record: %v", err)
+	}
+	return ref, nil
+}
+
+// storeContent stores the manifest by its content, unless somebody stored
+// the same one before, and returns the index record for the file
+func (n *Node) storeContent(ctx context.Context, m manifest) ([]byte, error) {
+	ciphertext, key, err := convergentEncrypt(m.encode())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(ciphertext)
+	ref := contentRef{Content: contentKeyPrefix + hex.EncodeToString(sum[:]), Secret: hex.EncodeToString(key)}
+	if found, base := n.stored(ctx, ref.Content); !found {
+		if err := n.storeChunk(ctx, ref.Content, ciphertext, base); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(indexMagic), data...), nil
+}
+
+// fetchContent returns the manifest ref points at
+func (n *Node) fetchContent(ctx context.Context, ref contentRef) (ReadResult, manifest, error) {
+	res, err := n.read(ctx, ref.Content)
+	if err != nil {
+		return res, manifest{}, err
+	}
+	if !res.Found {
+		return res, manifest{}, fmt.Errorf("content %s not found", ref.Content)
+	}
+	sum := sha1.Sum(res.Item.Value)
+	if contentKeyPrefix+hex.EncodeToString(sum[:]) != ref.Content {
+		return res, manifest{}, fmt.Errorf("content %s is corrupt", ref.Content)
+	}
+	key, err := hex.DecodeString(ref.Secret)
+	if err != nil {
+		return res, manifest{}, fmt.Errorf("invalid content reference: %v", err)
+	}
+	data, err := convergentDecrypt(res.Item.Value, key)
+	if err != nil {
+		return res, manifest{}, err
+	}
+	m, ok, err := parseManifest(data)
+	if err == nil && !ok {
+		err = errors.New("content is not a manifest")
+	}
+	return res, m, err
+}
+
+// IsContentRef reports whether s is a content reference, which LookupFile
+// takes in place of a file name and password
+func IsContentRef(s string) bool {
+	_, ok := parseContentRef(s)
+	return ok
+}
+
+// ContentRef returns the content reference of a file stored by content,
+// given what Lookup read under its name
+func (n *Node) ContentRef(value []byte, name string, password string) (string, bool) {
+	ref, ok := n.storedContentRef(value, name, newKeyring(password))
+	if !ok {
+		return "", false
+	}
+	return ref.String(), true
+}
+
+// storedContentRef returns the content reference of a file stored by
+// content, from the envelope stored under its name
+func (n *Node) storedContentRef(value []byte, name string, keys *keyring) (contentRef, bool) {
+	e, dataKey, err := openFile(value, name, keys, n.Identity)
+	if err != nil || e.Index == nil {
+		return contentRef{}, false
+	}
+	index, err := newDataKeyring(dataKey).open(e.Index, name)
+	if err != nil {
+		return contentRef{}, false
+	}
+	ref, err := parseIndex(index)
+	return ref, err == nil
+}
+
+// stored reports whether key is already stored, and otherwise the version
+// a new write of it has to beat
+func (n *Node) stored(ctx context.Context, key string) (bool, Version) {
+	res, err := n.readVersion(ctx, key)
+	if err != nil {
+		return false, Version{}
+	}
+	return res.Found, res.Item.Version
+}
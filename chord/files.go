@@ -0,0 +1,600 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// files are encrypted and stored in chunks of this many bytes
+	defaultChunkSize = 1 << 20
+	// quorum reads and repair fetch a chunk in a single message, which
+	// gRPC limits to 4 MiB; leave room for the sealing and the rest of it
+	maxChunkSize = 3 << 20
+	// how often a chunk is tried before the upload gives up
+	chunkAttempts = 3
+
+	manifestMagic  = "chord-manifest 1\n"
+	chunkKeyPrefix = "chunk/"
+)
+
+// manifest lists the chunks of a file. The file is cut into chunks that
+// are encrypted one by one and stored under the hash of their content,
+// which spreads them over the ring. The manifest goes into the envelope
+// stored under the name of the file.
+type manifest struct {
+	Size   int64      `json:"size"`
+	Chunks []chunkRef `json:"chunks"`
+	// Checksum is the SHA-256 of the file, so that a manifest cut short or
+	// otherwise tampered with does not go unnoticed. In an envelope, where
+	// everybody can read the manifest, it is sealed with the data key.
+	Checksum []byte `json:"checksum,omitempty"`
+}
+
+type chunkRef struct {
+	Key  string `json:"key"`
+	Size int    `json:"size"` // of the encrypted chunk
+	// the key the chunk is encrypted with in content-addressed mode; other
+	// chunks are encrypted with the data key of the file
+	Secret string `json:"secret,omitempty"`
+}
+
+func (m manifest) encode() []byte {
+	data, _ := json.Marshal(m)
+	return append([]byte(manifestMagic), data...)
+}
+
+// parseManifest reads a manifest. Before envelopes, manifests were stored
+// under the name of a file as they are, with chunks encrypted with the
+// password. It returns false for other values, like a file from before
+// files were chunked, which is the whole file encrypted in one piece.
+func parseManifest(value []byte) (manifest, bool, error) {
+	var m manifest
+	data, ok := bytes.CutPrefix(value, []byte(manifestMagic))
+	if !ok {
+		return m, false, nil
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, false, fmt.Errorf("invalid manifest: %v", err)
+	}
+	return m, true, nil
+}
+
+// storedSize returns the size of the file stored as value, or -1 if only
+// the password tells
+func storedSize(value []byte) int64 {
+	if e, ok, _ := parseEnvelope(value); ok && e.Manifest != nil {
+		return e.Manifest.Size
+	}
+	if m, ok, _ := parseManifest(value); ok {
+		return m.Size
+	}
+	return -1
+}
+
+// isFileKey reports whether key holds a file, rather than a chunk or the
+// content of files stored by content
+func isFileKey(key string) bool {
+	return !strings.HasPrefix(key, chunkKeyPrefix) && !strings.HasPrefix(key, contentKeyPrefix)
+}
+
+// checkChunkSize rejects a chunk size whose chunks could not be read back;
+// zero stands for the default
+func checkChunkSize(size int) error {
+	if size < 0 || size > maxChunkSize {
+		return fmt.Errorf("chunk size must be between 1 and %d bytes, not %d", maxChunkSize, size)
+	}
+	return nil
+}
+
+// chunkKey returns the key a chunk is stored under
+func chunkKey(data []byte) string {
+	sum := sha1.Sum(data)
+	return chunkKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// fileKey returns the key the file name is stored under. With a NameKey
+// it is a keyed hash of the name, so that the nodes holding the file do
+// not learn its name.
+func (n *Node) fileKey(name string) string {
+	if n.NameKey == nil {
+		return name
+	}
+	mac := hmac.New(sha256.New, n.NameKey)
+	mac.Write([]byte(name))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// FileID returns where on the ring a file is stored: by the hash of its
+// key, or of its content for a content reference
+func (n *Node) FileID(name string) *big.Int {
+	if ref, ok := parseContentRef(name); ok {
+		return hash(ref.Content)
+	}
+	return hash(n.fileKey(name))
+}
+
+// upload is the progress of a StoreFile. It is kept on disk, so that
+// storing the same file again after a failed upload only sends the chunks
+// that did not make it.
+type upload struct {
+	Size      int64      `json:"size"`
+	ModTime   time.Time  `json:"mod_time"`
+	ChunkSize int        `json:"chunk_size"`
+	Dedup     bool       `json:"dedup"`
+	Key       []byte     `json:"key"`    // the data key, sealed with the password
+	Chunks    []chunkRef `json:"chunks"` // the chunks stored so far, in order
+}
+
+// uploadPath returns where the progress of storing the local file at
+// localPath under name is kept
+func (n *Node) uploadPath(localPath, name string) string {
+	if abs, err := filepath.Abs(localPath); err == nil {
+		localPath = abs
+	}
+	sum := sha1.Sum([]byte(localPath + "\x00" + name))
+	return filepath.Join(n.UploadDir, hex.EncodeToString(sum[:]))
+}
+
+// loadUpload returns the progress of an earlier upload of the file, or a
+// fresh one if there is none or the file changed since
+func (n *Node) loadUpload(journal string, info os.FileInfo) *upload {
+	fresh := &upload{Size: info.Size(), ModTime: info.ModTime(), ChunkSize: n.ChunkSize, Dedup: n.Dedup}
+	data, err := os.ReadFile(journal)
+	if err != nil {
+		return fresh
+	}
+	var up upload
+	if err := json.Unmarshal(data, &up); err != nil {
+		return fresh
+	}
+	if up.Size != fresh.Size || !up.ModTime.Equal(fresh.ModTime) || up.ChunkSize != fresh.ChunkSize || up.Dedup != fresh.Dedup {
+		return fresh
+	}
+	return &up
+}
+
+func (n *Node) saveUpload(journal string, up *upload) error {
+	if journal == "" {
+		return nil
+	}
+	data, err := json.Marshal(up)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(n.UploadDir, 0o700); err != nil {
+		return err
+	}
+	return writeFileSync(n.UploadDir, journal, data)
+}
+
+func (n *Node) storeFile(ctx context.Context, localPath string, password string, expected *Version) (QuorumResult, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return QuorumResult{}, fmt.Errorf("failed to read file: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return QuorumResult{}, fmt.Errorf("failed to read file: %v", err)
+	}
+	name := path.Base(localPath)
+	journal := n.uploadPath(localPath, name)
+	return n.storeFrom(ctx, name, f, n.loadUpload(journal, info), journal, password, expected)
+}
+
+// StoreReader stores what r yields as the file name, like StoreFile. As
+// there is no local file to come back to, a failed upload starts over.
+func (n *Node) StoreReader(ctx context.Context, name string, r io.Reader, password string) (QuorumResult, error) {
+	return n.storeReader(ctx, name, r, password, nil)
+}
+
+// storeReader is StoreReader, conditional on expected unless it is nil
+func (n *Node) storeReader(ctx context.Context, name string, r io.Reader, password string, expected *Version) (QuorumResult, error) {
+	up := &upload{ChunkSize: n.ChunkSize, Dedup: n.Dedup}
+	return n.storeFrom(ctx, name, r, up, "", password, expected)
+}
+
+// storeFrom uploads the chunks of r, continuing up, and writes the file
+// name pointing at them. The progress is kept in journal, if not empty.
+func (n *Node) storeFrom(ctx context.Context, name string, r io.Reader, up *upload, journal string, password string, expected *Version) (QuorumResult, error) {
+	key := n.fileKey(name)
+
+	// a conditional store that is bound to fail does so before the upload
+	cur, err := n.read(ctx, key)
+	if err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to store file: %w", err)
+	}
+	if expected == nil {
+		expected = &cur.Item.Version
+	} else if expected.Less(cur.Item.Version) {
+		return cur.QuorumResult, fmt.Errorf("failed to store file: %w: %s is at version %s, newer than %s", errConflict, name, cur.Item.Version, expected)
+	}
+
+	keys := newKeyring(password)
+	m, dataKey, err := n.uploadChunks(ctx, r, up, journal, name, keys)
+	if err != nil {
+		return QuorumResult{}, fmt.Errorf("failed to store file: %w", err)
+	}
+	e := envelope{Manifest: &m}
+	if !n.Dedup {
+		m.Checksum, err = newDataKeyring(dataKey).seal(m.Checksum, checksumAAD(name))
+		if err != nil {
+			return QuorumResult{}, fmt.Errorf("failed to store file: %w", err)
+		}
+	} else {
+		index, err := n.storeContent(ctx, m)
+		if err == nil {
+			e = envelope{}
+			e.Index, err = newDataKeyring(dataKey).seal(index, name)
+		}
+		if err != nil {
+			return QuorumResult{}, fmt.Errorf("failed to store file: %w", err)
+		}
+	}
+	// whoever the file was shared with can read the new version too
+	var recipients []*ecdh.PublicKey
+	if old, ok, _ := parseEnvelope(cur.Item.Value); ok {
+		if recipients, err = old.recipientKeys(); err != nil {
+			return QuorumResult{}, fmt.Errorf("failed to store file: %w", err)
+		}
+	}
+	if err := e.seal(dataKey, name, keys, recipients); err != nil {
+		return QuorumResult{}, fmt.Errorf("failed to store file: %w", err)
+	}
+	res, err := n.write(ctx, key, e.encode(), false, expected)
+	if err != nil {
+		return res, fmt.Errorf("failed to store file: %w", err)
+	}
+	if journal != "" {
+		os.Remove(journal)
+	}
+	// the chunks of the version we replaced are not needed anymore
+	if cur.Found && cur.Item.Version == *expected {
+		n.dropChunks(ctx, cur.Item)
+	}
+	return res, nil
+}
+
+// uploadChunks encrypts and stores the chunks of r with a new data key,
+// skipping the ones an earlier upload recorded in up, and returns the
+// manifest, with the checksum in the clear, and the data key
+func (n *Node) uploadChunks(ctx context.Context, r io.Reader, up *upload, journal string, name string, keys *keyring) (manifest, []byte, error) {
+	var dataKey []byte
+	if len(up.Chunks) > 0 {
+		// the data key of the earlier upload only opens with its password
+		var err error
+		if dataKey, err = keys.open(up.Key, name); err != nil {
+			log.Printf("StoreFile: not resuming the earlier upload: %v", err)
+			up.Chunks = nil
+		} else {
+			log.Printf("StoreFile: resuming the earlier upload after %d chunks", len(up.Chunks))
+		}
+	}
+	if len(up.Chunks) == 0 {
+		var err error
+		if dataKey, err = newDataKey(); err != nil {
+			return manifest{}, nil, err
+		}
+		if up.Key, err = keys.seal(dataKey, name); err != nil {
+			return manifest{}, nil, err
+		}
+	}
+	// the chunks stored before still count towards the checksum
+	sum := sha256.New()
+	size, err := io.CopyN(sum, r, int64(len(up.Chunks))*int64(up.ChunkSize))
+	if err != nil {
+		return manifest{}, nil, err
+	}
+	data := newDataKeyring(dataKey)
+
+	buf := make([]byte, up.ChunkSize)
+	deduped := 0
+	for {
+		k, err := io.ReadFull(r, buf)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return manifest{}, nil, err
+		}
+		ref, sealed, err := n.encryptChunk(buf[:k], data, chunkAAD(name, len(up.Chunks)))
+		if err != nil {
+			return manifest{}, nil, fmt.Errorf("failed to encrypt file: %v", err)
+		}
+		// a chunk stored by content may be there already
+		found, base := false, Version{}
+		if ref.Secret != "" {
+			found, base = n.stored(ctx, ref.Key)
+		}
+		if found {
+			deduped++
+		} else if err := n.storeChunk(ctx, ref.Key, sealed, base); err != nil {
+			return manifest{}, nil, err
+		}
+		up.Chunks = append(up.Chunks, ref)
+		size += int64(k)
+		sum.Write(buf[:k])
+		if err := n.saveUpload(journal, up); err != nil {
+			log.Printf("StoreFile: failed to record the progress of the upload: %v", err)
+		}
+	}
+	if deduped > 0 {
+		log.Printf("StoreFile: %d chunks were already stored", deduped)
+	}
+	return manifest{Size: size, Chunks: up.Chunks, Checksum: sum.Sum(nil)}, dataKey, nil
+}
+
+// encryptChunk encrypts a chunk with the data key, or by its content in
+// content-addressed mode
+func (n *Node) encryptChunk(chunk []byte, keys *keyring, aad string) (chunkRef, []byte, error) {
+	if !n.Dedup {
+		data, err := keys.seal(chunk, aad)
+		return chunkRef{Key: chunkKey(data), Size: len(data)}, data, err
+	}
+	data, key, err := convergentEncrypt(chunk)
+	return chunkRef{Key: chunkKey(data), Size: len(data), Secret: hex.EncodeToString(key)}, data, err
+}
+
+// checksumAAD binds the sealed checksum of a file to its name
+func checksumAAD(name string) string {
+	return name + "\x00checksum"
+}
+
+// chunkAAD binds the i-th chunk of a file to the name and place of the
+// chunk, so that chunks cannot be swapped within a file or between files
+func chunkAAD(name string, i int) string {
+	return fmt.Sprintf("%s\x00%d", name, i)
+}
+
+// storeChunk writes a chunk to its replicas, trying again a few times if
+// too few of them took it. Chunks never change, so any version newer than
+// base will do.
+func (n *Node) storeChunk(ctx context.Context, key string, data []byte, base Version) error {
+	item := Item{Value: data, Version: n.nextVersion(base)}
+	var err error
+	for attempt := range chunkAttempts {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			}
+		}
+		if _, err = n.replicate(ctx, key, item, nil); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to store chunk %s: %w", key, err)
+}
+
+// storedFile is a file found by resolveFile
+type storedFile struct {
+	res  ReadResult
+	m    manifest
+	keys *keyring // the chunks are encrypted with
+	sum  []byte   // the SHA-256 of the file, if it was recorded
+	// a file from before files were chunked has no manifest, just this
+	whole []byte
+	// nothing showed that the keys open the file: a manifest from before
+	// envelopes that lists no chunk encrypted with the password
+	unchecked bool
+}
+
+// resolveFile finds the manifest of the file stored under name and opens
+// it with the password, or with identity if the file was shared with it.
+// A reference to content, as contentRef prints it, may stand in for the
+// name and password.
+func (n *Node) resolveFile(ctx context.Context, name string, password string, identity *ecdh.PrivateKey) (storedFile, error) {
+	keys := newKeyring(password)
+	if ref, ok := parseContentRef(name); ok {
+		res, m, err := n.fetchContent(ctx, ref)
+		return storedFile{res: res, m: m, keys: keys, sum: m.Checksum}, err
+	}
+	res, err := n.Lookup(ctx, n.fileKey(name))
+	f := storedFile{res: res, keys: keys}
+	if err != nil || !res.Found {
+		return f, err
+	}
+	if _, ok, _ := parseEnvelope(res.Item.Value); ok {
+		e, dataKey, err := openFile(res.Item.Value, name, keys, identity)
+		if err != nil {
+			return f, err
+		}
+		f.keys = newDataKeyring(dataKey)
+		if e.Manifest != nil {
+			f.m = *e.Manifest
+			if f.m.Checksum != nil {
+				f.sum, err = f.keys.open(f.m.Checksum, checksumAAD(name))
+			}
+			return f, err
+		}
+		index, err := f.keys.open(e.Index, name)
+		if err != nil {
+			return f, err
+		}
+		ref, err := parseIndex(index)
+		if err != nil {
+			return f, err
+		}
+		_, f.m, err = n.fetchContent(ctx, ref)
+		f.sum = f.m.Checksum
+		return f, err
+	}
+	m, ok, err := parseManifest(res.Item.Value)
+	if err != nil {
+		return f, err
+	}
+	if !ok {
+		f.whole, err = keys.open(res.Item.Value, name)
+		return f, err
+	}
+	// such a manifest is not encrypted, so only a chunk shows whether the
+	// password is right
+	f.m = m
+	i := slices.IndexFunc(m.Chunks, func(ref chunkRef) bool { return ref.Secret == "" })
+	if i < 0 {
+		f.unchecked = true
+		return f, nil
+	}
+	_, err = n.fetchChunk(ctx, m.Chunks[i], keys, chunkAAD(name, i))
+	return f, err
+}
+
+// size returns the size of the file
+func (f storedFile) size() int64 {
+	if f.whole != nil {
+		return int64(len(f.whole))
+	}
+	return f.m.Size
+}
+
+// checksum returns the SHA-256 of the file, or nil if it was not recorded
+func (f storedFile) checksum() []byte {
+	if f.whole != nil {
+		sum := sha256.Sum256(f.whole)
+		return sum[:]
+	}
+	return f.sum
+}
+
+// copyFile decrypts the file f, found under name, into w
+func (n *Node) copyFile(ctx context.Context, f storedFile, name string, w io.Writer) error {
+	if f.whole != nil {
+		_, err := w.Write(f.whole)
+		return err
+	}
+	return n.fetchChunks(ctx, f.m, name, f.keys, f.sum, w)
+}
+
+// fetchFile decrypts the file stored under name into w, with the password
+// or our Identity, see resolveFile
+func (n *Node) fetchFile(ctx context.Context, name string, password string, w io.Writer) (ReadResult, error) {
+	f, err := n.resolveFile(ctx, name, password, n.Identity)
+	if err != nil || !f.res.Found {
+		return f.res, err
+	}
+	return f.res, n.copyFile(ctx, f, name, w)
+}
+
+// FileStat is what StatFile tells about a file
+type FileStat struct {
+	Size     int64
+	Checksum []byte // SHA-256 of the content
+}
+
+// StatFile returns the size and checksum of the file name, opened like
+// FetchFile. Files carry their checksum; only files stored before they did
+// are read in whole to compute it.
+func (n *Node) StatFile(ctx context.Context, name string, password string) (FileStat, ReadResult, error) {
+	f, err := n.resolveFile(ctx, name, password, n.Identity)
+	if err != nil || !f.res.Found {
+		return FileStat{}, f.res, err
+	}
+	stat := FileStat{Size: f.size(), Checksum: f.checksum()}
+	if stat.Checksum == nil {
+		h := sha256.New()
+		if err := n.fetchChunks(ctx, f.m, name, f.keys, nil, h); err != nil {
+			return FileStat{}, f.res, err
+		}
+		stat.Checksum = h.Sum(nil)
+	}
+	return stat, f.res, nil
+}
+
+// fetchChunks decrypts the chunks of the file name that m lists into w,
+// and checks the file against sum unless it is nil. The chunks are written
+// as they arrive, so w has seen the whole file before it is checked.
+func (n *Node) fetchChunks(ctx context.Context, m manifest, name string, keys *keyring, sum []byte, w io.Writer) error {
+	h := sha256.New()
+	for i, ref := range m.Chunks {
+		data, err := n.fetchChunk(ctx, ref, keys, chunkAAD(name, i))
+		if err != nil {
+			return err
+		}
+		h.Write(data)
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if sum != nil && !bytes.Equal(h.Sum(nil), sum) {
+		return fmt.Errorf("checksum mismatch: %s is not the file that was stored", name)
+	}
+	return nil
+}
+
+// fetchChunk fetches a chunk from its replicas and decrypts it. If a
+// transfer breaks off, the next replica carries on where it stopped.
+func (n *Node) fetchChunk(ctx context.Context, ref chunkRef, keys *keyring, aad string) ([]byte, error) {
+	_, replicas, err := n.replicaSet(ctx, ref.Key)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(ref.Size)
+	var failures []string
+	for _, r := range replicas {
+		item, found, err := n.peer(r.Address).GetStream(ctx, ref.Key, int64(buf.Len()), &buf)
+		if err == nil && (!found || item.Deleted) {
+			err = errors.New("not found")
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", r.Address, err))
+			continue
+		}
+		break
+	}
+	if buf.Len() != ref.Size {
+		return nil, fmt.Errorf("failed to fetch chunk %s: %s", ref.Key, strings.Join(failures, "; "))
+	}
+	// chunks are stored under their hash, so a bad replica cannot slip us
+	// a different one
+	if chunkKey(buf.Bytes()) != ref.Key {
+		return nil, fmt.Errorf("chunk %s is corrupt", ref.Key)
+	}
+	if ref.Secret != "" {
+		key, err := hex.DecodeString(ref.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key for chunk %s: %v", ref.Key, err)
+		}
+		return convergentDecrypt(buf.Bytes(), key)
+	}
+	return keys.open(buf.Bytes(), aad)
+}
+
+// dropChunks deletes the chunks of a version of a file that was replaced
+// or deleted. Chunks it fails to delete are only wasted space. Content
+// that may be shared, behind an index record, is left alone.
+func (n *Node) dropChunks(ctx context.Context, old Item) {
+	m, ok, err := parseManifest(old.Value)
+	if e, isEnvelope, _ := parseEnvelope(old.Value); isEnvelope && e.Manifest != nil {
+		m, ok, err = *e.Manifest, true, nil
+	}
+	if err != nil || !ok {
+		return
+	}
+	// newer than the chunks, which were written before the manifest
+	tombstone := Item{Version: n.nextVersion(old.Version), Deleted: true}
+	for _, ref := range m.Chunks {
+		if _, err := n.replicate(ctx, ref.Key, tombstone, nil); err != nil {
+			log.Printf("failed to delete chunk %s: %v", ref.Key, err)
+		}
+	}
+}
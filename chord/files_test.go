@@ -0,0 +1,283 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"math/rand"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// randomData returns size bytes that do not compress or repeat
+func randomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// manifestOf returns the manifest in the envelope stored under name
+func manifestOf(t *testing.T, n *Node, name string) manifest {
+	t.Helper()
+	res, err := n.Lookup(context.Background(), name)
+	if err != nil || !res.Found {
+		t.Fatalf("Lookup(%s) = found %v, %v", name, res.Found, err)
+	}
+	e, ok, err := parseEnvelope(res.Item.Value)
+	if err != nil || !ok || e.Manifest == nil {
+		t.Fatalf("%s has no manifest: %v", name, err)
+	}
+	return *e.Manifest
+}
+
+func TestStoreFileInChunks(t *testing.T) {
+	r := newTestRing(t, 10)
+	ctx := context.Background()
+	client := r.nodes[2]
+	// chunks larger than a frame, so that they are streamed
+	client.ChunkSize = 100 << 10
+	data := randomData(1, 1000<<10+123)
+	file := writeTestFile(t, "big.bin", data)
+
+	if _, err := client.StoreFile(ctx, file, "pw"); err != nil {
+		t.Fatal(err)
+	}
+	m := manifestOf(t, client, "big.bin")
+	if len(m.Chunks) != 11 || m.Size != int64(len(data)) {
+		t.Fatalf("manifest has %d chunks for %d bytes, want 11 for %d", len(m.Chunks), m.Size, len(data))
+	}
+	var keys []string
+	owners := make(map[*Node]bool)
+	for _, ref := range m.Chunks {
+		keys = append(keys, ref.Key)
+		owners[r.owner(hash(ref.Key))] = true
+	}
+	r.checkReplicas(keys)
+	if len(owners) < 2 {
+		t.Errorf("all chunks are on the same node")
+	}
+	if got, _, err := r.nodes[7].LookupFile(ctx, "big.bin", "pw"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("LookupFile = %d bytes, %v; want the %d bytes stored", len(got), err, len(data))
+	}
+
+	// replacing the file deletes its old chunks, and so does deleting it
+	data = randomData(2, 300<<10)
+	if _, err := client.StoreFile(ctx, writeTestFile(t, "big.bin", data), "pw"); err != nil {
+		t.Fatal(err)
+	}
+	deleted := func(keys []string) {
+		t.Helper()
+		for _, k := range keys {
+			if item, ok, _ := r.owner(hash(k)).Bucket.Get(k); !ok || !item.Deleted {
+				t.Errorf("chunk %s was not deleted", k)
+			}
+		}
+	}
+	deleted(keys)
+	if got, _, err := r.nodes[7].LookupFile(ctx, "big.bin", "pw"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("LookupFile after replacing = %d bytes, %v; want %d", len(got), err, len(data))
+	}
+	keys = keys[:0]
+	for _, ref := range manifestOf(t, client, "big.bin").Chunks {
+		keys = append(keys, ref.Key)
+	}
+	if _, err := client.DeleteFile(ctx, "big.bin"); err != nil {
+		t.Fatal(err)
+	}
+	deleted(keys)
+}
+
+func TestStoreFileResumesUpload(t *testing.T) {
+	r := newTestRing(t, 6)
+	ctx := context.Background()
+	client := r.nodes[1]
+	client.ChunkSize = 1 << 10
+	data := randomData(3, 40<<10)
+	file := writeTestFile(t, "resume.bin", data)
+
+	// the connection drops part way through the upload
+	var calls atomic.Int64
+	r.transport.setIntercept(func(context.Context, string, string) error {
+		if calls.Add(1) > 100 {
+			return status.Error(codes.Unavailable, "connection dropped")
+		}
+		return nil
+	})
+	if _, err := client.StoreFile(ctx, file, "pw"); err == nil {
+		t.Fatal("StoreFile succeeded with the connection down")
+	}
+	r.transport.setIntercept(nil)
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal := client.uploadPath(file, "resume.bin")
+	done := client.loadUpload(journal, info).Chunks
+	if len(done) == 0 || len(done) == 40 {
+		t.Fatalf("the failed upload stored %d of 40 chunks", len(done))
+	}
+
+	// storing it again picks up where it stopped
+	if _, err := client.StoreFile(ctx, file, "pw"); err != nil {
+		t.Fatal(err)
+	}
+	m := manifestOf(t, client, "resume.bin")
+	if len(m.Chunks) != 40 {
+		t.Fatalf("manifest has %d chunks, want 40", len(m.Chunks))
+	}
+	for i, ref := range done {
+		if m.Chunks[i] != ref {
+			t.Fatalf("chunk %d was uploaded again", i)
+		}
+	}
+	if got, _, err := r.nodes[4].LookupFile(ctx, "resume.bin", "pw"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("LookupFile = %d bytes, %v; want the %d bytes stored", len(got), err, len(data))
+	}
+	if _, err := os.Stat(journal); !os.IsNotExist(err) {
+		t.Errorf("the progress of the finished upload was kept")
+	}
+}
+
+func TestChecksumCatchesTamperedManifest(t *testing.T) {
+	r := newTestRing(t, 6)
+	ctx := context.Background()
+	client := r.nodes[3]
+	client.ChunkSize = 1 << 10
+	data := randomData(4, 3<<10)
+	if _, err := client.StoreFile(ctx, writeTestFile(t, "cut.bin", data), "pw"); err != nil {
+		t.Fatal(err)
+	}
+	stat, _, err := r.nodes[0].StatFile(ctx, "cut.bin", "pw")
+	if want := sha256.Sum256(data); err != nil || stat.Size != int64(len(data)) || !bytes.Equal(stat.Checksum, want[:]) {
+		t.Fatalf("StatFile = %d bytes, %x, %v; want %d bytes, %x", stat.Size, stat.Checksum, err, len(data), want)
+	}
+
+	// somebody holding the envelope drops the last chunk from the manifest,
+	// which still opens with the password
+	res, err := client.Lookup(ctx, "cut.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _, _ := parseEnvelope(res.Item.Value)
+	e.Manifest.Chunks = e.Manifest.Chunks[:2]
+	e.Manifest.Size = 2 << 10
+	tampered := Item{Value: e.encode(), Version: client.nextVersion(res.Item.Version)}
+	if _, err := client.replicate(ctx, "cut.bin", tampered, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.nodes[0].LookupFile(ctx, "cut.bin", "pw"); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("LookupFile of a truncated file: %v, want a checksum mismatch", err)
+	}
+}
+
+func TestDedupStoresContentOnce(t *testing.T) {
+	r := newTestRing(t, 8)
+	ctx := context.Background()
+	alice, bob := r.nodes[1], r.nodes[5]
+	for _, n := range []*Node{alice, bob} {
+		n.Dedup = true
+		n.ChunkSize = 1 << 10
+	}
+	// five copies of one chunk and five different ones
+	data := append(bytes.Repeat(randomData(6, 1<<10), 5), randomData(7, 5<<10)...)
+
+	// the same content under two names, with different passwords
+	if _, err := alice.StoreFile(ctx, writeTestFile(t, "a.bin", data), "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.StoreFile(ctx, writeTestFile(t, "b.bin", data), "bob"); err != nil {
+		t.Fatal(err)
+	}
+	stored := func(prefix string) map[string]bool {
+		keys := make(map[string]bool)
+		for _, n := range r.nodes {
+			err := n.Bucket.Range(func(k string, item Item) bool {
+				if strings.HasPrefix(k, prefix) && !item.Deleted {
+					keys[k] = true
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return keys
+	}
+	if chunks := stored(chunkKeyPrefix); len(chunks) != 6 {
+		t.Errorf("%d distinct chunks stored, want 6", len(chunks))
+	}
+	if content := stored(contentKeyPrefix); len(content) != 1 {
+		t.Errorf("%d manifests stored by content, want 1", len(content))
+	}
+
+	for name, pw := range map[string]string{"a.bin": "alice", "b.bin": "bob"} {
+		if got, _, err := r.nodes[3].LookupFile(ctx, name, pw); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("LookupFile(%s) = %d bytes, %v; want %d", name, len(got), err, len(data))
+		}
+	}
+	if _, _, err := r.nodes[3].LookupFile(ctx, "a.bin", "bob"); err == nil {
+		t.Errorf("LookupFile with the wrong password succeeded")
+	}
+
+	// the reference in the index record reads the file by itself
+	res, err := alice.Lookup(ctx, "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, ok := alice.storedContentRef(res.Item.Value, "a.bin", newKeyring("alice"))
+	if !ok {
+		t.Fatalf("a.bin has no index record")
+	}
+	if got, _, err := r.nodes[6].LookupFile(ctx, ref.String(), ""); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("LookupFile(%s) = %d bytes, %v", ref, len(got), err)
+	}
+
+	// deleting one name leaves the content to the other
+	if _, err := alice.DeleteFile(ctx, "a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := r.nodes[3].LookupFile(ctx, "b.bin", "bob"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("LookupFile(b.bin) after deleting a.bin = %d bytes, %v", len(got), err)
+	}
+}
+
+func TestNameKeyHidesFileNames(t *testing.T) {
+	r := newTestRing(t, 6)
+	ctx := context.Background()
+	client := r.nodes[2]
+	client.NameKey = []byte("our secret")
+	data := []byte("the plans")
+	if _, err := client.StoreFile(ctx, writeTestFile(t, "secret-plans.txt", data), "pw"); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range r.nodes {
+		n.Bucket.Range(func(k string, item Item) bool {
+			if strings.Contains(k, "secret-plans") {
+				t.Errorf("%s stores the file under its name: %s", n.Address, k)
+			}
+			return true
+		})
+	}
+
+	if got, _, err := client.LookupFile(ctx, "secret-plans.txt", "pw"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("LookupFile = %q, %v; want %q", got, err, data)
+	}
+	// without the key the name leads nowhere
+	if got, _, err := r.nodes[4].LookupFile(ctx, "secret-plans.txt", "pw"); err != nil || got != nil {
+		t.Errorf("LookupFile without the key = %q, %v; want not found", got, err)
+	}
+	if _, err := client.DeleteFile(ctx, "secret-plans.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := client.LookupFile(ctx, "secret-plans.txt", "pw"); err != nil || got != nil {
+		t.Errorf("LookupFile after DeleteFile = %q, %v; want not found", got, err)
+	}
+	if _, err := client.DeleteFile(ctx, "secret-plans.txt"); !IsNotFound(err) {
+		t.Errorf("DeleteFile of a deleted file: got %v, want errNotFound", err)
+	}
+}
@@ -0,0 +1,334 @@
+package chord
+
+import (
+	"context"
+	"crypto/ecdh"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The HTTP gateway lets clients that cannot speak our gRPC protocol store
+// and read files through a node. Files go through the same code as from
+// the shell, encrypted on the node with the password from passwordHeader.
+// A file shared with a key is read with the private key in keyHeader; the
+// node's own Identity is never used for a caller. Overwriting or deleting
+// a file takes its password. Versions travel as ETags, and If-Match makes
+// a write or delete conditional on one.
+const (
+	passwordHeader = "X-Chord-Password"
+	keyHeader      = "X-Chord-Key"
+	checksumHeader = "X-Chord-Sha256"
+)
+
+// MarshalJSON writes the reference as its address and hexadecimal
+// identifier, or null for no node
+func (r NodeRef) MarshalJSON() ([]byte, error) {
+	if r.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(struct {
+		Address    string `json:"address"`
+		Identifier string `json:"identifier"`
+	}{r.Address, fmt.Sprintf("%040x", r.Identifier)})
+}
+
+// Handler returns the HTTP gateway of the node:
+//
+//	PUT    /files/{name}  store the request body as the file
+//	GET    /files/{name}  read the file, HEAD for its size and version
+//	DELETE /files/{name}  delete the file, given its password
+//	GET    /ring          the nodes of the ring, in order
+//	GET    /node          the state of this node
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /files/{name...}", n.handlePut)
+	mux.HandleFunc("GET /files/{name...}", n.handleGet)
+	mux.HandleFunc("DELETE /files/{name...}", n.handleDelete)
+	mux.HandleFunc("GET /ring", n.handleRing)
+	mux.HandleFunc("GET /node", n.handleNode)
+	return mux
+}
+
+// replicaStatus is how a replica answered, as the gateway reports it
+type replicaStatus struct {
+	Node  NodeRef `json:"node"`
+	OK    bool    `json:"ok"`
+	Error string  `json:"error,omitempty"`
+}
+
+// writeStatus is the answer to a PUT or DELETE
+type writeStatus struct {
+	Name     string          `json:"name"`
+	Owner    NodeRef         `json:"owner"`
+	Replicas []replicaStatus `json:"replicas"`
+}
+
+func newWriteStatus(name string, res QuorumResult) writeStatus {
+	s := writeStatus{Name: name, Owner: res.Owner, Replicas: []replicaStatus{}}
+	for _, r := range res.Replicas {
+		rs := replicaStatus{Node: r.Node, OK: r.Err == nil}
+		if r.Err != nil {
+			rs.Error = r.Err.Error()
+		}
+		s.Replicas = append(s.Replicas, rs)
+	}
+	return s
+}
+
+func (n *Node) handlePut(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	password := r.Header.Get(passwordHeader)
+	if name == "" || IsContentRef(name) {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("invalid file name %q", name))
+		return
+	}
+	if password == "" {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("no password in %s", passwordHeader))
+		return
+	}
+	expected, _, ok := n.checkWrite(w, r, name)
+	if !ok {
+		return
+	}
+	res, err := n.storeReader(r.Context(), name, r.Body, password, expected)
+	if err != nil {
+		httpFail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newWriteStatus(name, res))
+}
+
+func (n *Node) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" || IsContentRef(name) {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("invalid file name %q", name))
+		return
+	}
+	expected, found, ok := n.checkWrite(w, r, name)
+	if !ok {
+		return
+	}
+	// a file that is not there is not found, unless If-Match names the
+	// version to delete
+	if !found && r.Header.Get("If-Match") == "" {
+		httpError(w, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+	res, err := n.deleteFile(r.Context(), name, expected)
+	if err != nil {
+		httpFail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newWriteStatus(name, res))
+}
+
+func (n *Node) handleGet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("invalid file name %q", name))
+		return
+	}
+	identity, ok := requestKey(w, r)
+	if !ok {
+		return
+	}
+	// the headers and the body come from the same version of the file
+	f, err := n.resolveFile(r.Context(), name, r.Header.Get(passwordHeader), identity)
+	if err != nil {
+		httpFail(w, r, err)
+		return
+	}
+	if !f.res.Found {
+		httpError(w, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(f.size(), 10))
+	w.Header().Set("ETag", strconv.Quote(f.res.Item.Version.String()))
+	if sum := f.checksum(); sum != nil {
+		w.Header().Set(checksumHeader, hex.EncodeToString(sum))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	out := &trackingWriter{w: w}
+	if err := n.copyFile(r.Context(), f, name, out); err != nil {
+		if !out.wrote {
+			for _, h := range []string{"Content-Length", "ETag", checksumHeader} {
+				w.Header().Del(h)
+			}
+			httpFail(w, r, err)
+			return
+		}
+		// the status is out already; cutting the response short is the
+		// only way left to tell the client
+		log.Printf("gateway: GET %s: %v", name, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (n *Node) handleRing(w http.ResponseWriter, r *http.Request) {
+	ring, err := walkRing(r.Context(), n.transport, []string{n.Address}, nil)
+	if err != nil {
+		httpError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ring)
+}
+
+// nodeStatus is the answer to GET /node
+type nodeStatus struct {
+	Self        NodeRef   `json:"self"`
+	Predecessor NodeRef   `json:"predecessor"`
+	Successors  []NodeRef `json:"successors"`
+	Fingers     []NodeRef `json:"fingers"` // the distinct ones, in order
+	Items       int       `json:"items"`
+	Replicas    int       `json:"replicas"`
+	ReadQuorum  int       `json:"read_quorum"`
+	WriteQuorum int       `json:"write_quorum"`
+	AntiEntropy struct {
+		Rounds    int64 `json:"rounds"`
+		Differing int64 `json:"differing"`
+		Pulled    int64 `json:"pulled"`
+		Pushed    int64 `json:"pushed"`
+		Failed    int64 `json:"failed"`
+	} `json:"anti_entropy"`
+}
+
+func (n *Node) handleNode(w http.ResponseWriter, r *http.Request) {
+	var s nodeStatus
+	n.mu.RLock()
+	s.Self = n.self()
+	s.Predecessor = n.Predecessor
+	s.Successors = append([]NodeRef{}, n.Successors...)
+	s.Fingers = []NodeRef{}
+	for _, f := range n.FingerTable {
+		if !f.IsZero() && (len(s.Fingers) == 0 || s.Fingers[len(s.Fingers)-1].Address != f.Address) {
+			s.Fingers = append(s.Fingers, f)
+		}
+	}
+	n.mu.RUnlock()
+	err := n.Bucket.RangeKeys(func(string, Item) bool {
+		s.Items++
+		return true
+	})
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.Replicas, s.ReadQuorum, s.WriteQuorum = n.Replicas, n.ReadQuorum, n.WriteQuorum
+	stats := n.RepairStats()
+	s.AntiEntropy.Rounds = stats.Rounds
+	s.AntiEntropy.Differing = stats.Differing
+	s.AntiEntropy.Pulled = stats.Pulled
+	s.AntiEntropy.Pushed = stats.Pushed
+	s.AntiEntropy.Failed = stats.Failed
+	writeJSON(w, http.StatusOK, s)
+}
+
+// checkWrite checks that the password of a request to overwrite or delete
+// the file name opens it, and returns the version the write is to be
+// conditional on: the one the password was checked against, so that no
+// other version is replaced in between, and whether the file exists.
+// Creating a file that does not exist needs no password. It answers the
+// request itself if the check fails.
+func (n *Node) checkWrite(w http.ResponseWriter, r *http.Request, name string) (*Version, bool, bool) {
+	expected, ok := ifMatch(w, r)
+	if !ok {
+		return nil, false, false
+	}
+	f, err := n.resolveFile(r.Context(), name, r.Header.Get(passwordHeader), nil)
+	if err == nil && f.unchecked {
+		err = fmt.Errorf("%w: nothing in %s to check the password against", errDecrypt, name)
+	}
+	if err != nil {
+		httpFail(w, r, err)
+		return nil, false, false
+	}
+	// the zero version for a file that never existed
+	current := f.res.Item.Version
+	if expected != nil && *expected != current {
+		httpFail(w, r, fmt.Errorf("%w: %s is at version %s, not %s", errConflict, name, current, *expected))
+		return nil, false, false
+	}
+	return &current, f.res.Found, true
+}
+
+// requestKey reads the private key a request reads a shared file with, or
+// nil without one. It answers the request itself if the header is invalid.
+func requestKey(w http.ResponseWriter, r *http.Request) (*ecdh.PrivateKey, bool) {
+	h := r.Header.Get(keyHeader)
+	if h == "" {
+		return nil, true
+	}
+	key, err := parsePrivateKey(h)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %v", keyHeader, err))
+		return nil, false
+	}
+	return key, true
+}
+
+// ifMatch reads the version a request is conditional on. It answers the
+// request itself if the header is invalid.
+func ifMatch(w http.ResponseWriter, r *http.Request) (*Version, bool) {
+	h := r.Header.Get("If-Match")
+	if h == "" {
+		return nil, true
+	}
+	v, err := ParseVersion(strings.Trim(h, `"`))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("invalid If-Match: %v", err))
+		return nil, false
+	}
+	return &v, true
+}
+
+// httpFail answers a request that failed with err with the matching status
+func httpFail(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case IsConflict(err) && r.Header.Get("If-Match") != "":
+		code = http.StatusPreconditionFailed
+	case IsConflict(err):
+		code = http.StatusConflict
+	case errors.Is(err, errDecrypt):
+		code = http.StatusForbidden
+	case errors.Is(err, errNoQuorum) || isTimeout(err):
+		code = http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled):
+		// the client went away; nobody reads the answer
+		return
+	}
+	httpError(w, code, err)
+}
+
+func httpError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("gateway: writing answer: %v", err)
+	}
+}
+
+// trackingWriter notes whether anything was written to w
+type trackingWriter struct {
+	w     io.Writer
+	wrote bool
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	t.wrote = t.wrote || len(p) > 0
+	return t.w.Write(p)
+}
@@ -0,0 +1,278 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// do sends a request to the gateway and returns the status and body
+func do(t *testing.T, method, url string, body []byte, header ...string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, got
+}
+
+func TestGatewayFiles(t *testing.T) {
+	r := newTestRing(t, 10)
+	srv := httptest.NewServer(r.nodes[3].Handler())
+	defer srv.Close()
+	url := srv.URL + "/files/dir/report.bin"
+	data := randomData(2, 2*defaultChunkSize+5)
+
+	resp, body := do(t, "PUT", url, data, passwordHeader, "pw")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT = %d %s", resp.StatusCode, body)
+	}
+	var put struct {
+		Owner    struct{ Address string }
+		Replicas []struct{ OK bool }
+	}
+	if err := json.Unmarshal(body, &put); err != nil {
+		t.Fatal(err)
+	}
+	// a file stored through the gateway is one like any other
+	got, lookup, err := r.nodes[7].LookupFile(context.Background(), "dir/report.bin", "pw")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("LookupFile of what was PUT: %d bytes, %v", len(got), err)
+	}
+	if owner := r.owner(hash("dir/report.bin")); put.Owner.Address != owner.Address || len(put.Replicas) != r.nodes[3].Replicas {
+		t.Errorf("PUT answered %s, want owner %s and %d replicas", body, owner.Address, r.nodes[3].Replicas)
+	}
+
+	resp, body = do(t, "GET", url, nil, passwordHeader, "pw")
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("GET = %d with %d bytes", resp.StatusCode, len(body))
+	}
+	sum := sha256.Sum256(data)
+	if h := resp.Header.Get(checksumHeader); h != hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum header %q, want %x", h, sum)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag != `"`+lookup.Item.Version.String()+`"` {
+		t.Errorf("ETag %s, want version %s", etag, lookup.Item.Version)
+	}
+	if resp, body := do(t, "HEAD", url, nil, passwordHeader, "pw"); resp.ContentLength != int64(len(data)) || len(body) != 0 || resp.Header.Get("ETag") != etag {
+		t.Errorf("HEAD = %d bytes long with %d sent and ETag %s", resp.ContentLength, len(body), resp.Header.Get("ETag"))
+	}
+
+	for _, c := range []struct {
+		method, url, password, ifMatch string
+		want                           int
+	}{
+		{"GET", url, "wrong", "", http.StatusForbidden},
+		{"GET", srv.URL + "/files/missing", "pw", "", http.StatusNotFound},
+		{"GET", srv.URL + "/files/", "pw", "", http.StatusBadRequest},
+		{"DELETE", srv.URL + "/files/missing", "pw", "", http.StatusNotFound},
+		{"PUT", url, "", "", http.StatusBadRequest},
+		{"PUT", url, "pw", `"not a version"`, http.StatusBadRequest},
+		// replacing or deleting a file takes its password
+		{"PUT", url, "wrong", "", http.StatusForbidden},
+		{"DELETE", url, "", "", http.StatusForbidden},
+		{"DELETE", url, "wrong", "", http.StatusForbidden},
+	} {
+		if resp, body := do(t, c.method, c.url, []byte("x"), passwordHeader, c.password, "If-Match", c.ifMatch); resp.StatusCode != c.want {
+			t.Errorf("%s %s with %q: %d %s, want %d", c.method, c.url, c.password, resp.StatusCode, body, c.want)
+		}
+	}
+
+	// writes conditional on the version we read: the first wins, and the
+	// second is told it is too late
+	if resp, body := do(t, "PUT", url, []byte("second"), passwordHeader, "pw", "If-Match", etag); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT If-Match = %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := do(t, "PUT", url, []byte("third"), passwordHeader, "pw", "If-Match", etag); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a stale If-Match = %d, want %d", resp.StatusCode, http.StatusPreconditionFailed)
+	}
+	if resp, _ := do(t, "DELETE", url, nil, passwordHeader, "pw", "If-Match", etag); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with a stale If-Match = %d, want %d", resp.StatusCode, http.StatusPreconditionFailed)
+	}
+	if got, _, err := r.nodes[7].LookupFile(context.Background(), "dir/report.bin", "pw"); err != nil || string(got) != "second" {
+		t.Fatalf("after the refused writes the file is %q, %v; want the second", got, err)
+	}
+
+	if resp, body := do(t, "DELETE", url, nil, passwordHeader, "pw"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := do(t, "GET", url, nil, passwordHeader, "pw"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET after DELETE = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	if resp, _ := do(t, "DELETE", url, nil, passwordHeader, "pw"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("DELETE after DELETE = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	// nothing is written for a file that never existed
+	for _, n := range r.replicasOf("missing") {
+		if _, ok, _ := n.Bucket.Get("missing"); ok {
+			t.Errorf("%s keeps a tombstone of a file that never existed", n.Address)
+		}
+	}
+}
+
+func TestGatewayOldManifests(t *testing.T) {
+	r := newTestRing(t, 5)
+	ctx := context.Background()
+	n := r.nodes[1]
+	srv := httptest.NewServer(n.Handler())
+	defer srv.Close()
+
+	// before envelopes the manifest was stored as it is, and only its
+	// chunks were encrypted with the password
+	sealed, err := newKeyring("pw").seal([]byte("old file"), chunkAAD("old.txt", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.storeChunk(ctx, chunkKey(sealed), sealed, Version{}); err != nil {
+		t.Fatal(err)
+	}
+	old := manifest{Size: 8, Chunks: []chunkRef{{Key: chunkKey(sealed), Size: len(sealed)}}}
+	for name, m := range map[string]manifest{"old.txt": old, "empty.txt": {}} {
+		if _, err := n.write(ctx, n.fileKey(name), m.encode(), false, &Version{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	url := srv.URL + "/files/old.txt"
+	if resp, body := do(t, "GET", url, nil, passwordHeader, "pw"); resp.StatusCode != http.StatusOK || string(body) != "old file" {
+		t.Errorf("GET = %d %q", resp.StatusCode, body)
+	}
+	for _, c := range []struct{ method, url, password string }{
+		{"GET", url, "wrong"},
+		{"PUT", url, "wrong"},
+		{"DELETE", url, ""},
+		{"DELETE", url, "wrong"},
+		// nothing tells whether a password opens a file without chunks
+		{"DELETE", srv.URL + "/files/empty.txt", "pw"},
+	} {
+		if resp, body := do(t, c.method, c.url, []byte("x"), passwordHeader, c.password); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s with %q: %d %s, want %d", c.method, c.url, c.password, resp.StatusCode, body, http.StatusForbidden)
+		}
+	}
+	if got, _, err := n.LookupFile(ctx, "old.txt", "pw"); err != nil || string(got) != "old file" {
+		t.Fatalf("after the refused writes the file is %q, %v", got, err)
+	}
+	if resp, body := do(t, "DELETE", url, nil, passwordHeader, "pw"); resp.StatusCode != http.StatusOK {
+		t.Errorf("DELETE with the password = %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestGatewaySharedFiles(t *testing.T) {
+	r := newTestRing(t, 5)
+	ctx := context.Background()
+	n := r.nodes[2]
+	srv := httptest.NewServer(n.Handler())
+	defer srv.Close()
+	url := srv.URL + "/files/shared.txt"
+	if _, err := n.StoreReader(ctx, "shared.txt", strings.NewReader("for us"), "pw"); err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Identity, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []*ecdh.PrivateKey{n.Identity, other} {
+		if _, err := n.ShareFile(ctx, "shared.txt", "pw", key.PublicKey()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the node reads the file with its identity, a caller of the gateway
+	// only with a key of their own
+	if got, _, err := n.LookupFile(ctx, "shared.txt", ""); err != nil || string(got) != "for us" {
+		t.Fatalf("LookupFile with the identity = %q, %v", got, err)
+	}
+	if resp, _ := do(t, "GET", url, nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET without a password or key = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	if resp, body := do(t, "GET", url, nil, keyHeader, hex.EncodeToString(other.Bytes())); resp.StatusCode != http.StatusOK || string(body) != "for us" {
+		t.Errorf("GET with a key it is shared with = %d %q", resp.StatusCode, body)
+	}
+	if resp, _ := do(t, "GET", url, nil, keyHeader, "zz"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET with an invalid key = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	// a key reads the file, but only the password replaces it
+	if resp, _ := do(t, "DELETE", url, nil, keyHeader, hex.EncodeToString(other.Bytes())); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("DELETE with a key = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
+
+func TestGatewayStatus(t *testing.T) {
+	r := newTestRing(t, 10)
+	n := r.nodes[4]
+	srv := httptest.NewServer(n.Handler())
+	defer srv.Close()
+
+	resp, body := do(t, "GET", srv.URL+"/ring", nil)
+	var ring []struct{ Address, Identifier string }
+	if err := json.Unmarshal(body, &ring); resp.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("GET /ring = %d %s, %v", resp.StatusCode, body, err)
+	}
+	if len(ring) != 10 || ring[0].Address != n.Address {
+		t.Errorf("GET /ring has %d nodes starting at %v, want 10 from %s", len(ring), ring, n.Address)
+	}
+
+	resp, body = do(t, "GET", srv.URL+"/node", nil)
+	var status struct {
+		Self        struct{ Address string }
+		Predecessor struct{ Address string }
+		Successors  []struct{ Address string }
+		Replicas    int
+	}
+	if err := json.Unmarshal(body, &status); resp.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("GET /node = %d %s, %v", resp.StatusCode, body, err)
+	}
+	if status.Self.Address != n.Address || status.Predecessor.Address != n.Predecessor.Address ||
+		len(status.Successors) == 0 || status.Successors[0].Address != n.Successors[0].Address {
+		t.Errorf("GET /node = %s, does not match the node", body)
+	}
+	if status.Replicas != n.Replicas {
+		t.Errorf("GET /node has %d replicas, want %d", status.Replicas, n.Replicas)
+	}
+}
+
+func TestGatewayStartsAndStopsWithNode(t *testing.T) {
+	ca := newTestCA(t)
+	n, err := New(Config{Address: "127.0.0.1:0", HTTPAddress: "127.0.0.1:0", TLS: ca.issue("gateway")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + n.HTTPAddress() + "/node"
+	if resp, body := do(t, "GET", url, nil); resp.StatusCode != http.StatusOK || !strings.Contains(string(body), n.Address) {
+		t.Fatalf("GET /node = %d %s", resp.StatusCode, body)
+	}
+	if err := n.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("gateway still answers after Stop")
+	}
+}
@@ -0,0 +1,319 @@
+package chord
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memTransport connects nodes living in the same process by calling their
+// RPC handlers directly. It lets tests run a whole ring without sockets or
+// certificates, and take nodes down to simulate failures.
+type memTransport struct {
+	mu    sync.RWMutex
+	nodes map[string]*Node
+	down  map[string]bool
+
+	// intercept, if set, sees every call before it is made and can fail it
+	// or hold it up; ctx carries the deadline of the call
+	intercept func(ctx context.Context, address, method string) error
+	// timeouts overrides the default timeouts of methods, see callTimeouts
+	timeouts map[string]time.Duration
+}
+
+func newMemTransport() *memTransport {
+	return &memTransport{
+		nodes: make(map[string]*Node),
+		down:  make(map[string]bool),
+	}
+}
+
+// register makes n reachable at its address
+func (t *memTransport) register(n *Node) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nodes[n.Address] = n
+	delete(t.down, n.Address)
+}
+
+// setDown makes calls to address fail as if the node had crashed, or
+// brings it back
+func (t *memTransport) setDown(address string, down bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.down[address] = down
+}
+
+// setIntercept installs fn as the interceptor of every call, or removes it
+func (t *memTransport) setIntercept(fn func(ctx context.Context, address, method string) error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.intercept = fn
+}
+
+func (t *memTransport) Peer(address string) Peer {
+	return &memPeer{address: address, t: t}
+}
+
+func (t *memTransport) Close() error {
+	return nil
+}
+
+type memPeer struct {
+	address string
+	t       *memTransport
+}
+
+func (p *memPeer) Address() string {
+	return p.address
+}
+
+// node returns the node behind the peer, or the error a gRPC client would
+// see if it could not be reached
+func (p *memPeer) node(ctx context.Context, method string) (*Node, error) {
+	p.t.mu.RLock()
+	n, ok := p.t.nodes[p.address]
+	down := p.t.down[p.address]
+	intercept := p.t.intercept
+	p.t.mu.RUnlock()
+	if !ok || down {
+		return nil, status.Errorf(codes.Unavailable, "%s is unreachable", p.address)
+	}
+	if intercept != nil {
+		if err := intercept(ctx, p.address, method); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return n, nil
+}
+
+// do calls the node behind the peer within the method's timeout, like
+// grpcPeer.do
+func (p *memPeer) do(ctx context.Context, method string, call func(context.Context, *Node) error) error {
+	return withTimeout(ctx, p.address, method, methodTimeout(p.t.timeouts, method), func(ctx context.Context) error {
+		n, err := p.node(ctx, method)
+		if err != nil {
+			return err
+		}
+		return call(ctx, n)
+	})
+}
+
+func (p *memPeer) Ping(ctx context.Context) error {
+	return p.do(ctx, "Ping", func(ctx context.Context, n *Node) error {
+		_, err := n.Ping(ctx, &pb.PingRequest{})
+		return err
+	})
+}
+
+func (p *memPeer) FindSuccessor(ctx context.Context, id *big.Int) (NodeRef, error) {
+	var ref NodeRef
+	err := p.do(ctx, "FindSuccessor", func(ctx context.Context, n *Node) error {
+		resp, err := n.FindSuccessor(ctx, &pb.FindSuccessorRequest{Id: id.Bytes()})
+		if err != nil {
+			return err
+		}
+		ref = newNodeRef(resp.Adress, resp.Identifier)
+		return nil
+	})
+	return ref, err
+}
+
+func (p *memPeer) GetPredecessor(ctx context.Context) (Neighbours, error) {
+	var nb Neighbours
+	err := p.do(ctx, "GetPredecessor", func(ctx context.Context, n *Node) error {
+		resp, err := n.GetPredecessor(ctx, &pb.GetPredecessorRequest{})
+		if err != nil {
+			return err
+		}
+		nb = neighboursFromResponse(p.address, resp)
+		return nil
+	})
+	return nb, err
+}
+
+func (p *memPeer) Notify(ctx context.Context, self NodeRef) error {
+	return p.do(ctx, "Notify", func(ctx context.Context, n *Node) error {
+		_, err := n.Notify(ctx, &pb.NotifyRequest{Address: self.Address, Identifier: self.idBytes()})
+		return err
+	})
+}
+
+func (p *memPeer) Leave(ctx context.Context, leaving Neighbours) error {
+	return p.do(ctx, "Leave", func(ctx context.Context, n *Node) error {
+		_, err := n.Leave(ctx, leaveRequest(leaving))
+		return err
+	})
+}
+
+func (p *memPeer) Get(ctx context.Context, key string) (Item, bool, error) {
+	return p.get(ctx, "Get", &pb.GetRequest{Key: key})
+}
+
+func (p *memPeer) Head(ctx context.Context, key string) (Item, bool, error) {
+	return p.get(ctx, "Get", &pb.GetRequest{Key: key, VersionOnly: true})
+}
+
+func (p *memPeer) get(ctx context.Context, method string, req *pb.GetRequest) (Item, bool, error) {
+	var item Item
+	var found bool
+	err := p.do(ctx, method, func(ctx context.Context, n *Node) error {
+		resp, err := n.Get(ctx, req)
+		if err != nil {
+			return err
+		}
+		item, found = itemFromGetResponse(resp)
+		return nil
+	})
+	return item, found, err
+}
+
+func (p *memPeer) Put(ctx context.Context, key string, value []byte, version Version, expected *Version) error {
+	return p.do(ctx, "Put", func(ctx context.Context, n *Node) error {
+		_, err := n.Put(ctx, &pb.PutRequest{Key: key, Value: value, Version: version.toProto(), Expected: expectedToProto(expected)})
+		return err
+	})
+}
+
+func (p *memPeer) Delete(ctx context.Context, key string, version Version, expected *Version) error {
+	return p.do(ctx, "Delete", func(ctx context.Context, n *Node) error {
+		_, err := n.Delete(ctx, &pb.DeleteRequest{Key: key, Version: version.toProto(), Expected: expectedToProto(expected)})
+		return err
+	})
+}
+
+func (p *memPeer) PutStream(ctx context.Context, key string, value []byte, version Version, expected *Version) error {
+	return p.do(ctx, "PutStream", func(ctx context.Context, n *Node) error {
+		return n.PutStream(&memPutStream{ctx: ctx, frames: putStreamFrames(key, value, version, expected)})
+	})
+}
+
+func (p *memPeer) GetStream(ctx context.Context, key string, offset int64, w io.Writer) (Item, bool, error) {
+	var item Item
+	var found bool
+	err := p.do(ctx, "GetStream", func(ctx context.Context, n *Node) error {
+		stream := &memServerStream[pb.GetStreamResponse]{ctx: ctx}
+		if err := n.GetStream(&pb.GetStreamRequest{Key: key, Offset: offset}, stream); err != nil {
+			return err
+		}
+		var err error
+		item, found, err = readGetStream(stream.recv, offset, w)
+		return err
+	})
+	return item, found, err
+}
+
+func (p *memPeer) GetAll(ctx context.Context, start, end *big.Int) (map[string]Item, error) {
+	var items map[string]Item
+	err := p.do(ctx, "GetAll", func(ctx context.Context, n *Node) error {
+		stream := &memServerStream[pb.GetAllResponse]{ctx: ctx}
+		if err := n.GetAll(getAllRequest(start, end), stream); err != nil {
+			return err
+		}
+		var err error
+		items, err = readItems(stream.recv)
+		return err
+	})
+	return items, err
+}
+
+func (p *memPeer) ListKeys(ctx context.Context, start, end *big.Int, filesOnly bool) ([]KeyInfo, error) {
+	var keys []KeyInfo
+	err := p.do(ctx, "ListKeys", func(ctx context.Context, n *Node) error {
+		stream := &memServerStream[pb.ListKeysResponse]{ctx: ctx}
+		if err := n.ListKeys(listKeysRequest(start, end, filesOnly), stream); err != nil {
+			return err
+		}
+		var err error
+		keys, err = readKeys(stream.recv)
+		return err
+	})
+	return keys, err
+}
+
+func (p *memPeer) MerkleTree(ctx context.Context, start, end *big.Int, depth int, nodes []int) ([][]byte, error) {
+	var hashes [][]byte
+	err := p.do(ctx, "MerkleTree", func(ctx context.Context, n *Node) error {
+		resp, err := n.MerkleTree(ctx, merkleTreeRequest(start, end, depth, nodes))
+		if err != nil {
+			return err
+		}
+		hashes = resp.Hashes
+		return nil
+	})
+	return hashes, err
+}
+
+func (p *memPeer) MerkleKeys(ctx context.Context, start, end *big.Int, depth int, leaves []int) (map[string]Item, error) {
+	var items map[string]Item
+	err := p.do(ctx, "MerkleKeys", func(ctx context.Context, n *Node) error {
+		resp, err := n.MerkleKeys(ctx, merkleKeysRequest(start, end, depth, leaves))
+		if err != nil {
+			return err
+		}
+		items = itemsFromProto(resp.Items)
+		return nil
+	})
+	return items, err
+}
+
+// memPutStream hands the frames of a PutStream to its handler. The
+// embedded ServerStream is nil: the handler only needs what is below.
+type memPutStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	frames []*pb.PutStreamRequest
+}
+
+func (s *memPutStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *memPutStream) Recv() (*pb.PutStreamRequest, error) {
+	if len(s.frames) == 0 {
+		return nil, io.EOF
+	}
+	frame := s.frames[0]
+	s.frames = s.frames[1:]
+	return frame, nil
+}
+
+func (s *memPutStream) SendAndClose(*pb.PutResponse) error {
+	return nil
+}
+
+// memServerStream collects the frames a streaming handler sends
+type memServerStream[T any] struct {
+	grpc.ServerStream
+	ctx    context.Context
+	frames []*T
+}
+
+func (s *memServerStream[T]) Context() context.Context {
+	return s.ctx
+}
+
+func (s *memServerStream[T]) Send(frame *T) error {
+	s.frames = append(s.frames, frame)
+	return nil
+}
+
+func (s *memServerStream[T]) recv() (*T, error) {
+	if len(s.frames) == 0 {
+		return nil, io.EOF
+	}
+	frame := s.frames[0]
+	s.frames = s.frames[1:]
+	return frame, nil
+}
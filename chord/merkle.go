@@ -0,0 +1,329 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"math/big"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// the trees we compare have 2^merkleDepth leaves
+	merkleDepth = 8
+	// deeper trees than this are refused, they would only cost memory
+	maxMerkleDepth = 16
+
+	defaultAntiEntropyInterval = 30 * time.Second
+)
+
+// RepairStats counts what anti-entropy did on a node since it started
+type RepairStats struct {
+	Rounds    int64 // ranges compared with a replica
+	Differing int64 // keys found to differ between the two
+	Pulled    int64 // keys fetched because the replica had a newer version
+	Pushed    int64 // keys sent because we had a newer version
+	Failed    int64 // comparisons or transfers that failed
+}
+
+type repairCounters struct {
+	rounds, differing, pulled, pushed, failed atomic.Int64
+}
+
+// RepairStats returns what anti-entropy has repaired so far
+func (n *Node) RepairStats() RepairStats {
+	return RepairStats{
+		Rounds:    n.repairs.rounds.Load(),
+		Differing: n.repairs.differing.Load(),
+		Pulled:    n.repairs.pulled.Load(),
+		Pushed:    n.repairs.pushed.Load(),
+		Failed:    n.repairs.failed.Load(),
+	}
+}
+
+// merkleTree summarises the keys of a store in the range (start, end].
+// The range is cut into 2^depth equal parts, one per leaf. A leaf hashes
+// the keys in its part with their versions, so two trees differ exactly
+// under the leaves where the two stores hold different versions.
+type merkleTree struct {
+	hashes [][]byte        // every node of the tree, root first
+	leaves [][]string      // the keys under each leaf, sorted
+	items  map[string]Item // the keys in the range, without values
+}
+
+// newMerkleTree builds the tree over the keys of items that lie in
+// (start, end]; start == end means the whole ring
+func newMerkleTree(items map[string]Item, start, end *big.Int, depth int) *merkleTree {
+	width := new(big.Int).Sub(end, start)
+	width.Mod(width, hashMod)
+	if width.Sign() == 0 {
+		width.Set(hashMod)
+	}
+	t := &merkleTree{
+		hashes: make([][]byte, 1<<(depth+1)-1),
+		leaves: make([][]string, 1<<depth),
+		items:  make(map[string]Item),
+	}
+	for k, item := range items {
+		id := hash(k)
+		if !between(start, id, end, true) {
+			continue
+		}
+		// the leaf is where id falls in the range: offset 1 is the first
+		// id in it and width the last
+		offset := new(big.Int).Sub(id, start)
+		offset.Mod(offset, hashMod)
+		if offset.Sign() == 0 {
+			offset.Set(hashMod)
+		}
+		offset.Sub(offset, big.NewInt(1))
+		offset.Lsh(offset, uint(depth))
+		leaf := int(offset.Div(offset, width).Int64())
+		t.leaves[leaf] = append(t.leaves[leaf], k)
+		t.items[k] = Item{Version: item.Version, Deleted: item.Deleted}
+	}
+
+	first := len(t.leaves) - 1
+	for i, keys := range t.leaves {
+		slices.Sort(keys)
+		h := sha1.New()
+		for _, k := range keys {
+			item := t.items[k]
+			fmt.Fprintf(h, "%q %s %t\n", k, item.Version, item.Deleted)
+		}
+		t.hashes[first+i] = h.Sum(nil)
+	}
+	for i := first - 1; i >= 0; i-- {
+		h := sha1.New()
+		h.Write(t.hashes[2*i+1])
+		h.Write(t.hashes[2*i+2])
+		t.hashes[i] = h.Sum(nil)
+	}
+	return t
+}
+
+// merkleTree returns the tree over our keys in (start, end]. Trees are
+// kept until the next write to the bucket, since building one means
+// reading every item and a comparison asks for the same tree many times.
+func (n *Node) merkleTree(start, end *big.Int, depth int) (*merkleTree, error) {
+	cacheKey := fmt.Sprintf("%x-%x-%d", start, end, depth)
+	n.merkleMu.Lock()
+	gen := n.bucketGen.Load()
+	if n.merkleGen != gen {
+		n.merkleGen = gen
+		n.merkleCache = nil
+	}
+	if t, ok := n.merkleCache[cacheKey]; ok {
+		n.merkleMu.Unlock()
+		return t, nil
+	}
+	n.merkleMu.Unlock()
+
+	items := make(map[string]Item)
+	err := n.Bucket.RangeKeys(func(k string, item Item) bool {
+		items[k] = item
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	t := newMerkleTree(items, start, end, depth)
+
+	n.merkleMu.Lock()
+	defer n.merkleMu.Unlock()
+	// a tree built while the bucket changed is returned, but not kept
+	if n.merkleGen == gen {
+		if n.merkleCache == nil {
+			n.merkleCache = make(map[string]*merkleTree)
+		}
+		n.merkleCache[cacheKey] = t
+	}
+	return t, nil
+}
+
+// merkleRequest checks the range and depth of a tree request
+func (n *Node) merkleRequest(start, end []byte, depth uint32) (*merkleTree, error) {
+	if depth > maxMerkleDepth {
+		return nil, status.Errorf(codes.InvalidArgument, "depth %d is over %d", depth, maxMerkleDepth)
+	}
+	t, err := n.merkleTree(new(big.Int).SetBytes(start), new(big.Int).SetBytes(end), int(depth))
+	if err != nil {
+		return nil, fmt.Errorf("merkle: %v", err)
+	}
+	return t, nil
+}
+
+// MerkleTree implements the MerkleTree RPC method
+func (n *Node) MerkleTree(ctx context.Context, req *pb.MerkleTreeRequest) (*pb.MerkleTreeResponse, error) {
+	t, err := n.merkleRequest(req.Start, req.End, req.Depth)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.MerkleTreeResponse{}
+	for _, i := range req.Nodes {
+		if int(i) >= len(t.hashes) {
+			return nil, status.Errorf(codes.InvalidArgument, "no node %d in a tree of depth %d", i, req.Depth)
+		}
+		resp.Hashes = append(resp.Hashes, t.hashes[i])
+	}
+	return resp, nil
+}
+
+// MerkleKeys implements the MerkleKeys RPC method
+func (n *Node) MerkleKeys(ctx context.Context, req *pb.MerkleKeysRequest) (*pb.MerkleKeysResponse, error) {
+	t, err := n.merkleRequest(req.Start, req.End, req.Depth)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.MerkleKeysResponse{}
+	for _, leaf := range req.Leaves {
+		if int(leaf) >= len(t.leaves) {
+			return nil, status.Errorf(codes.InvalidArgument, "no leaf %d in a tree of depth %d", leaf, req.Depth)
+		}
+		for _, k := range t.leaves[leaf] {
+			item := t.items[k]
+			resp.Items = append(resp.Items, &pb.Item{Key: k, Version: item.Version.toProto(), Deleted: item.Deleted})
+		}
+	}
+	return resp, nil
+}
+
+// antiEntropy compares the keys we are responsible for with each of the
+// successors holding their replicas, and repairs the keys that differ.
+// Re-replication only copies keys when the ring changes; this catches the
+// writes and deletes a replica missed while it was cut off.
+func (n *Node) antiEntropy(ctx context.Context) {
+	nb := n.neighbours()
+	if nb.Predecessor.IsZero() {
+		// we do not know where our range starts
+		return
+	}
+	for _, h := range replicaHolders(nb, n.Replicas) {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := n.repairRange(ctx, h, nb.Predecessor.Identifier, nb.Self.Identifier); err != nil {
+			n.repairs.failed.Add(1)
+			log.Printf("anti-entropy: %s: %v", h, err)
+		}
+	}
+}
+
+// repairRange brings the keys in (start, end] on us and the node at
+// address up to the newer version of each. It walks down both Merkle
+// trees from the root, only following the subtrees whose hashes differ,
+// and then transfers the keys under the leaves that differ.
+func (n *Node) repairRange(ctx context.Context, address string, start, end *big.Int) error {
+	n.repairs.rounds.Add(1)
+	local, err := n.merkleTree(start, end, merkleDepth)
+	if err != nil {
+		return err
+	}
+	peer := n.peer(address)
+
+	level := []int{0}
+	var leaves []int
+	for depth := 0; ; depth++ {
+		hashes, err := peer.MerkleTree(ctx, start, end, merkleDepth, level)
+		if err != nil {
+			return err
+		}
+		if len(hashes) != len(level) {
+			return fmt.Errorf("asked for %d hashes, got %d", len(level), len(hashes))
+		}
+		var differ []int
+		for i, node := range level {
+			if !bytes.Equal(hashes[i], local.hashes[node]) {
+				differ = append(differ, node)
+			}
+		}
+		if len(differ) == 0 {
+			return nil
+		}
+		if depth == merkleDepth {
+			first := len(local.leaves) - 1
+			for _, node := range differ {
+				leaves = append(leaves, node-first)
+			}
+			break
+		}
+		level = level[:0]
+		for _, node := range differ {
+			level = append(level, 2*node+1, 2*node+2)
+		}
+	}
+
+	remote, err := peer.MerkleKeys(ctx, start, end, merkleDepth, leaves)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]bool)
+	for _, leaf := range leaves {
+		for _, k := range local.leaves[leaf] {
+			keys[k] = true
+		}
+	}
+	for k := range remote {
+		keys[k] = true
+	}
+	differing, pulled, pushed, failed := 0, 0, 0, 0
+	for k := range keys {
+		mine, haveMine := local.items[k]
+		theirs, haveTheirs := remote[k]
+		if haveMine && haveTheirs && mine.Version == theirs.Version {
+			continue
+		}
+		differing++
+		if !haveMine || (haveTheirs && mine.Version.Less(theirs.Version)) {
+			err = n.pull(ctx, peer, k)
+			if err == nil {
+				pulled++
+			}
+		} else {
+			err = n.push(ctx, address, k)
+			if err == nil {
+				pushed++
+			}
+		}
+		if err != nil {
+			log.Printf("anti-entropy: %s: %v", k, err)
+			failed++
+		}
+	}
+	n.repairs.differing.Add(int64(differing))
+	n.repairs.pulled.Add(int64(pulled))
+	n.repairs.pushed.Add(int64(pushed))
+	n.repairs.failed.Add(int64(failed))
+	if differing > 0 {
+		log.Printf("anti-entropy: %d keys differed from %s: pulled %d, pushed %d, %d failed", differing, address, pulled, pushed, failed)
+	}
+	return nil
+}
+
+// pull fetches key from peer and keeps it if it is newer than ours
+func (n *Node) pull(ctx context.Context, peer Peer, key string) error {
+	item, found, err := peer.Get(ctx, key)
+	if err != nil || !found {
+		return err
+	}
+	_, err = n.store(key, item, nil)
+	return err
+}
+
+// push sends our version of key to the node at address
+func (n *Node) push(ctx context.Context, address string, key string) error {
+	item, found, err := n.Bucket.Get(key)
+	if err != nil || !found {
+		return err
+	}
+	return n.pushItem(ctx, address, key, item, nil)
+}
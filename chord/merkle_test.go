@@ -0,0 +1,131 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestMerkleTreeDiffersOnlyAboveChangedLeaf(t *testing.T) {
+	items := make(map[string]Item)
+	for i := 0; i < 200; i++ {
+		items[fmt.Sprintf("key-%03d", i)] = Item{Value: []byte("v"), Version: Version{Clock: 1, Writer: "a"}}
+	}
+	start, end := big.NewInt(0), big.NewInt(0) // the whole ring
+	const depth = 4
+	before := newMerkleTree(items, start, end, depth)
+	if n := len(before.items); n != len(items) {
+		t.Fatalf("tree over the whole ring has %d keys, want %d", n, len(items))
+	}
+
+	items["key-042"] = Item{Value: []byte("v"), Version: Version{Clock: 2, Writer: "a"}}
+	after := newMerkleTree(items, start, end, depth)
+
+	// exactly the path from the root to the leaf of key-042 changed
+	leaf := -1
+	for i, keys := range after.leaves {
+		for _, k := range keys {
+			if k == "key-042" {
+				leaf = i
+			}
+		}
+	}
+	onPath := make(map[int]bool)
+	for node := len(after.leaves) - 1 + leaf; ; node = (node - 1) / 2 {
+		onPath[node] = true
+		if node == 0 {
+			break
+		}
+	}
+	for i := range after.hashes {
+		if differ := !bytes.Equal(before.hashes[i], after.hashes[i]); differ != onPath[i] {
+			t.Errorf("node %d: differs %v, on the path to the changed leaf %v", i, differ, onPath[i])
+		}
+	}
+
+	// a range only covers its own keys
+	half := new(big.Int).Rsh(hashMod, 1)
+	lower := newMerkleTree(items, start, half, depth)
+	for k := range lower.items {
+		if hash(k).Cmp(half) > 0 {
+			t.Errorf("%s is outside the range but in the tree", k)
+		}
+	}
+}
+
+func TestAntiEntropyRepairsReplicas(t *testing.T) {
+	r := newTestRing(t, 8)
+	ctx := context.Background()
+	var names []string
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("file-%02d", i)
+		if _, err := r.nodes[0].StoreFile(ctx, writeTestFile(t, name, []byte(name)), "pw"); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	// replicas drift apart: one misses a write, one loses a key, one has a
+	// write the others missed, and one misses a delete
+	newer := func(n *Node, key string, deleted bool) {
+		item, _, _ := n.Bucket.Get(key)
+		item.Version.Clock++
+		item.Deleted = deleted
+		if _, err := n.store(key, item, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newer(r.replicasOf(names[0])[0], names[0], false)
+	r.replicasOf(names[1])[1].Bucket.Delete(names[1])
+	newer(r.replicasOf(names[2])[2], names[2], false)
+	for _, n := range r.replicasOf(names[3])[:2] {
+		newer(n, names[3], true)
+	}
+
+	for range 2 {
+		for _, n := range r.live() {
+			n.antiEntropy(ctx)
+		}
+	}
+	for _, name := range names[:4] {
+		var want Item
+		for i, n := range r.replicasOf(name) {
+			item, ok, _ := n.Bucket.Get(name)
+			if !ok {
+				t.Fatalf("%s is missing on %s", name, n.Address)
+			}
+			if i == 0 {
+				want = item
+			} else if item.Version != want.Version {
+				t.Errorf("%s is at %s on %s, but at %s on the owner", name, item.Version, n.Address, want.Version)
+			}
+		}
+	}
+
+	// each key counts once per replica it was repaired on: the owner's
+	// newer write went to two replicas, the write only the last replica had
+	// was pulled by the owner and then pushed to the other one
+	var total RepairStats
+	before := make(map[*Node]RepairStats)
+	for _, n := range r.live() {
+		s := n.RepairStats()
+		before[n] = s
+		total.Differing += s.Differing
+		total.Pulled += s.Pulled
+		total.Pushed += s.Pushed
+		total.Failed += s.Failed
+	}
+	if total.Differing != 6 || total.Pulled != 1 || total.Pushed != 5 || total.Failed != 0 {
+		t.Errorf("repair stats %+v, want 6 keys differing, 1 pulled and 5 pushed", total)
+	}
+
+	// once in sync, another round finds nothing to do
+	for _, n := range r.live() {
+		n.antiEntropy(ctx)
+		if s := n.RepairStats(); s.Differing != before[n].Differing {
+			t.Errorf("%s repaired keys of replicas already in sync", n.Address)
+		}
+	}
+}
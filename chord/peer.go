@@ -0,0 +1,445 @@
+package chord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Peer is another node of the ring as the local node logic sees it. It
+// hides how the node is reached, so the transport can be swapped.
+type Peer interface {
+	Address() string
+
+	Ping(ctx context.Context) error
+	FindSuccessor(ctx context.Context, id *big.Int) (NodeRef, error)
+	GetPredecessor(ctx context.Context) (Neighbours, error)
+	Notify(ctx context.Context, self NodeRef) error
+	Leave(ctx context.Context, leaving Neighbours) error
+
+	// Get returns the version of key the peer holds, which may be a
+	// tombstone, and false if it holds none
+	Get(ctx context.Context, key string) (Item, bool, error)
+	// Head is Get without the value
+	Head(ctx context.Context, key string) (Item, bool, error)
+	// Put and Delete with expected set are refused with FailedPrecondition
+	// if the peer holds a newer version of key than expected
+	Put(ctx context.Context, key string, value []byte, version Version, expected *Version) error
+	Delete(ctx context.Context, key string, version Version, expected *Version) error
+	// PutStream is Put for large values, which are sent in frames
+	PutStream(ctx context.Context, key string, value []byte, version Version, expected *Version) error
+	// GetStream is Get for large values: it writes the value from offset
+	// on to w and returns the item without it. If the transfer breaks off,
+	// what arrived has been written, so it can be resumed from there.
+	GetStream(ctx context.Context, key string, offset int64, w io.Writer) (Item, bool, error)
+	// GetAll returns every item, tombstones included, whose key id lies in
+	// (start, end], or all of them if start and end are nil
+	GetAll(ctx context.Context, start, end *big.Int) (map[string]Item, error)
+	// ListKeys is GetAll without the values, only of the keys holding
+	// files if filesOnly is set
+	ListKeys(ctx context.Context, start, end *big.Int, filesOnly bool) ([]KeyInfo, error)
+
+	// MerkleTree returns the hashes of nodes of the peer's Merkle tree over
+	// the keys in (start, end], and MerkleKeys the keys under some of its
+	// leaves, with their versions but without values
+	MerkleTree(ctx context.Context, start, end *big.Int, depth int, nodes []int) ([][]byte, error)
+	MerkleKeys(ctx context.Context, start, end *big.Int, depth int, leaves []int) (map[string]Item, error)
+}
+
+// KeyInfo is what a node tells about a key it holds, without its value
+type KeyInfo struct {
+	Key     string
+	Version Version
+	Deleted bool
+	Size    int64 // of the file the key holds, -1 if only the password tells or it holds none
+}
+
+// Transport hands out peers by address
+type Transport interface {
+	Peer(address string) Peer
+	Close() error
+}
+
+// Neighbours is what a node tells others about its place in the ring
+type Neighbours struct {
+	Self        NodeRef
+	Predecessor NodeRef
+	Successors  []NodeRef
+}
+
+// grpcTransport reaches peers over TLS gRPC connections from a pool
+type grpcTransport struct {
+	conns    *connPool
+	timeouts map[string]time.Duration
+}
+
+// newGRPCTransport dials peers with the client side of files. timeouts
+// overrides defaultTimeouts per method.
+func newGRPCTransport(files TLSFiles, timeouts map[string]time.Duration) (*grpcTransport, error) {
+	creds, err := files.clientCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS credentials: %v", err)
+	}
+	return &grpcTransport{conns: newConnPool(creds, connIdleTimeout), timeouts: timeouts}, nil
+}
+
+func (t *grpcTransport) Peer(address string) Peer {
+	return &grpcPeer{address: address, t: t}
+}
+
+func (t *grpcTransport) Close() error {
+	t.conns.close()
+	return nil
+}
+
+// TimeoutMethods returns the methods whose timeout can be set, sorted
+func TimeoutMethods() []string {
+	var methods []string
+	for m := range defaultTimeouts {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// callTimeouts sets every method's timeout to timeout, if not zero, and
+// then the ones in overrides, which must all name methods
+func callTimeouts(timeout time.Duration, overrides map[string]time.Duration) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	if timeout != 0 {
+		for m := range defaultTimeouts {
+			timeouts[m] = timeout
+		}
+	}
+	for m, d := range overrides {
+		if _, ok := defaultTimeouts[m]; !ok {
+			return nil, fmt.Errorf("no method %q to set the timeout of, want one of %s", m, strings.Join(TimeoutMethods(), ", "))
+		}
+		timeouts[m] = d
+	}
+	return timeouts, nil
+}
+
+// methodTimeout returns how long we wait for a peer to answer method, as
+// set in timeouts or else by default
+func methodTimeout(timeouts map[string]time.Duration, method string) time.Duration {
+	if d, ok := timeouts[method]; ok {
+		return d
+	}
+	if d, ok := defaultTimeouts[method]; ok {
+		return d
+	}
+	return defaultTimeout
+}
+
+type grpcPeer struct {
+	address string
+	t       *grpcTransport
+}
+
+func (p *grpcPeer) Address() string {
+	return p.address
+}
+
+// do runs one RPC against the peer, giving up after the method's timeout
+// or when ctx is done
+func (p *grpcPeer) do(ctx context.Context, method string, rpc func(context.Context, pb.ChordClient) error) error {
+	pc, err := p.t.conns.get(p.address)
+	if err != nil {
+		return err
+	}
+	defer p.t.conns.release(pc)
+	//log.Printf("call: calling %s on %s", method, p.address)
+	return withTimeout(ctx, p.address, method, methodTimeout(p.t.timeouts, method), func(ctx context.Context) error {
+		return rpc(ctx, pc.client)
+	})
+}
+
+// withTimeout makes a call to method on the peer at address, giving up
+// after timeout with an error wrapping errTimeout
+func withTimeout(ctx context.Context, address, method string, timeout time.Duration, call func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := call(ctx)
+	if status.Code(err) == codes.DeadlineExceeded {
+		return fmt.Errorf("%s on %s: %w after %v", method, address, errTimeout, timeout)
+	}
+	return err
+}
+
+func (p *grpcPeer) Ping(ctx context.Context) error {
+	return p.do(ctx, "Ping", func(ctx context.Context, c pb.ChordClient) error {
+		_, err := c.Ping(ctx, &pb.PingRequest{})
+		return err
+	})
+}
+
+func (p *grpcPeer) FindSuccessor(ctx context.Context, id *big.Int) (NodeRef, error) {
+	var ref NodeRef
+	err := p.do(ctx, "FindSuccessor", func(ctx context.Context, c pb.ChordClient) error {
+		resp, err := c.FindSuccessor(ctx, &pb.FindSuccessorRequest{Id: id.Bytes()})
+		if err != nil {
+			return err
+		}
+		ref = newNodeRef(resp.Adress, resp.Identifier)
+		return nil
+	})
+	return ref, err
+}
+
+func (p *grpcPeer) GetPredecessor(ctx context.Context) (Neighbours, error) {
+	var nb Neighbours
+	err := p.do(ctx, "GetPredecessor", func(ctx context.Context, c pb.ChordClient) error {
+		resp, err := c.GetPredecessor(ctx, &pb.GetPredecessorRequest{})
+		if err != nil {
+			return err
+		}
+		nb = neighboursFromResponse(p.address, resp)
+		return nil
+	})
+	return nb, err
+}
+
+func (p *grpcPeer) Notify(ctx context.Context, self NodeRef) error {
+	return p.do(ctx, "Notify", func(ctx context.Context, c pb.ChordClient) error {
+		_, err := c.Notify(ctx, &pb.NotifyRequest{Address: self.Address, Identifier: self.idBytes()})
+		return err
+	})
+}
+
+func (p *grpcPeer) Leave(ctx context.Context, leaving Neighbours) error {
+	return p.do(ctx, "Leave", func(ctx context.Context, c pb.ChordClient) error {
+		_, err := c.Leave(ctx, leaveRequest(leaving))
+		return err
+	})
+}
+
+func (p *grpcPeer) Get(ctx context.Context, key string) (Item, bool, error) {
+	return p.get(ctx, &pb.GetRequest{Key: key})
+}
+
+func (p *grpcPeer) Head(ctx context.Context, key string) (Item, bool, error) {
+	return p.get(ctx, &pb.GetRequest{Key: key, VersionOnly: true})
+}
+
+func (p *grpcPeer) get(ctx context.Context, req *pb.GetRequest) (Item, bool, error) {
+	var resp *pb.GetResponse
+	err := p.do(ctx, "Get", func(ctx context.Context, c pb.ChordClient) error {
+		var err error
+		resp, err = c.Get(ctx, req)
+		return err
+	})
+	if err != nil {
+		return Item{}, false, err
+	}
+	item, found := itemFromGetResponse(resp)
+	return item, found, nil
+}
+
+func (p *grpcPeer) Put(ctx context.Context, key string, value []byte, version Version, expected *Version) error {
+	return p.do(ctx, "Put", func(ctx context.Context, c pb.ChordClient) error {
+		_, err := c.Put(ctx, &pb.PutRequest{Key: key, Value: value, Version: version.toProto(), Expected: expectedToProto(expected)})
+		return err
+	})
+}
+
+func (p *grpcPeer) Delete(ctx context.Context, key string, version Version, expected *Version) error {
+	return p.do(ctx, "Delete", func(ctx context.Context, c pb.ChordClient) error {
+		_, err := c.Delete(ctx, &pb.DeleteRequest{Key: key, Version: version.toProto(), Expected: expectedToProto(expected)})
+		return err
+	})
+}
+
+func (p *grpcPeer) PutStream(ctx context.Context, key string, value []byte, version Version, expected *Version) error {
+	return p.do(ctx, "PutStream", func(ctx context.Context, c pb.ChordClient) error {
+		stream, err := c.PutStream(ctx)
+		if err != nil {
+			return err
+		}
+		for _, frame := range putStreamFrames(key, value, version, expected) {
+			// a failed send is reported by CloseAndRecv
+			if stream.Send(frame) != nil {
+				break
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	})
+}
+
+func (p *grpcPeer) GetStream(ctx context.Context, key string, offset int64, w io.Writer) (Item, bool, error) {
+	var item Item
+	var found bool
+	err := p.do(ctx, "GetStream", func(ctx context.Context, c pb.ChordClient) error {
+		stream, err := c.GetStream(ctx, &pb.GetStreamRequest{Key: key, Offset: offset})
+		if err != nil {
+			return err
+		}
+		item, found, err = readGetStream(stream.Recv, offset, w)
+		return err
+	})
+	return item, found, err
+}
+
+func (p *grpcPeer) GetAll(ctx context.Context, start, end *big.Int) (map[string]Item, error) {
+	var items map[string]Item
+	err := p.do(ctx, "GetAll", func(ctx context.Context, c pb.ChordClient) error {
+		stream, err := c.GetAll(ctx, getAllRequest(start, end))
+		if err != nil {
+			return err
+		}
+		items, err = readItems(stream.Recv)
+		return err
+	})
+	return items, err
+}
+
+func (p *grpcPeer) ListKeys(ctx context.Context, start, end *big.Int, filesOnly bool) ([]KeyInfo, error) {
+	var keys []KeyInfo
+	err := p.do(ctx, "ListKeys", func(ctx context.Context, c pb.ChordClient) error {
+		stream, err := c.ListKeys(ctx, listKeysRequest(start, end, filesOnly))
+		if err != nil {
+			return err
+		}
+		keys, err = readKeys(stream.Recv)
+		return err
+	})
+	return keys, err
+}
+
+func (p *grpcPeer) MerkleTree(ctx context.Context, start, end *big.Int, depth int, nodes []int) ([][]byte, error) {
+	var hashes [][]byte
+	err := p.do(ctx, "MerkleTree", func(ctx context.Context, c pb.ChordClient) error {
+		resp, err := c.MerkleTree(ctx, merkleTreeRequest(start, end, depth, nodes))
+		if err != nil {
+			return err
+		}
+		hashes = resp.Hashes
+		return nil
+	})
+	return hashes, err
+}
+
+func (p *grpcPeer) MerkleKeys(ctx context.Context, start, end *big.Int, depth int, leaves []int) (map[string]Item, error) {
+	var items map[string]Item
+	err := p.do(ctx, "MerkleKeys", func(ctx context.Context, c pb.ChordClient) error {
+		resp, err := c.MerkleKeys(ctx, merkleKeysRequest(start, end, depth, leaves))
+		if err != nil {
+			return err
+		}
+		items = itemsFromProto(resp.Items)
+		return nil
+	})
+	return items, err
+}
+
+// neighboursFromResponse turns the GetPredecessor answer of the node at
+// address into Neighbours
+func neighboursFromResponse(address string, resp *pb.GetPredecessorResponse) Neighbours {
+	nb := Neighbours{
+		Self:        newNodeRef(address, resp.Identifier),
+		Predecessor: newNodeRef(resp.Address, resp.PredIdentifier),
+	}
+	for i, a := range resp.Successors {
+		var id []byte
+		if i < len(resp.SuccessorIdentifiers) {
+			id = resp.SuccessorIdentifiers[i]
+		}
+		nb.Successors = append(nb.Successors, newNodeRef(a, id))
+	}
+	return nb
+}
+
+// neighboursFromLeave is the inverse of leaveRequest
+func neighboursFromLeave(req *pb.LeaveRequest) Neighbours {
+	return neighboursFromResponse(req.Address, &pb.GetPredecessorResponse{
+		Identifier:           req.Identifier,
+		Address:              req.Pred,
+		PredIdentifier:       req.PredIdentifier,
+		Successors:           req.Successors,
+		SuccessorIdentifiers: req.SuccessorIdentifiers,
+	})
+}
+
+// leaveRequest tells the neighbours of a leaving node about each other
+func leaveRequest(leaving Neighbours) *pb.LeaveRequest {
+	req := &pb.LeaveRequest{
+		Address:        leaving.Self.Address,
+		Identifier:     leaving.Self.idBytes(),
+		Pred:           leaving.Predecessor.Address,
+		PredIdentifier: leaving.Predecessor.idBytes(),
+	}
+	for _, succ := range leaving.Successors {
+		req.Successors = append(req.Successors, succ.Address)
+		req.SuccessorIdentifiers = append(req.SuccessorIdentifiers, succ.idBytes())
+	}
+	return req
+}
+
+// getAllRequest asks for the keys in (start, end], or all keys if both are nil
+func getAllRequest(start, end *big.Int) *pb.GetAllRequest {
+	if start == nil && end == nil {
+		return &pb.GetAllRequest{}
+	}
+	return &pb.GetAllRequest{Start: rangeBound(start), End: rangeBound(end)}
+}
+
+func merkleTreeRequest(start, end *big.Int, depth int, nodes []int) *pb.MerkleTreeRequest {
+	req := &pb.MerkleTreeRequest{Start: rangeBound(start), End: rangeBound(end), Depth: uint32(depth)}
+	for _, i := range nodes {
+		req.Nodes = append(req.Nodes, uint32(i))
+	}
+	return req
+}
+
+func merkleKeysRequest(start, end *big.Int, depth int, leaves []int) *pb.MerkleKeysRequest {
+	req := &pb.MerkleKeysRequest{Start: rangeBound(start), End: rangeBound(end), Depth: uint32(depth)}
+	for _, i := range leaves {
+		req.Leaves = append(req.Leaves, uint32(i))
+	}
+	return req
+}
+
+func itemFromGetResponse(resp *pb.GetResponse) (Item, bool) {
+	return Item{Value: resp.Value, Version: versionFromProto(resp.Version), Deleted: resp.Deleted}, resp.Found
+}
+
+func listKeysRequest(start, end *big.Int, filesOnly bool) *pb.ListKeysRequest {
+	req := getAllRequest(start, end)
+	return &pb.ListKeysRequest{Start: req.Start, End: req.End, FilesOnly: filesOnly}
+}
+
+// readKeys reads the frames of a ListKeys until the stream ends
+func readKeys(recv func() (*pb.ListKeysResponse, error)) ([]KeyInfo, error) {
+	var keys []KeyInfo
+	for {
+		frame, err := recv()
+		if errors.Is(err, io.EOF) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range frame.Keys {
+			keys = append(keys, KeyInfo{Key: k.Key, Version: versionFromProto(k.Version), Deleted: k.Deleted, Size: k.Size})
+		}
+	}
+}
+
+func itemsFromProto(pbItems []*pb.Item) map[string]Item {
+	items := make(map[string]Item, len(pbItems))
+	for _, item := range pbItems {
+		items[item.Key] = Item{Value: item.Value, Version: versionFromProto(item.Version), Deleted: item.Deleted}
+	}
+	return items
+}
@@ -0,0 +1,118 @@
+package chord
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+)
+
+// how long a connection to another node may sit unused before we close it
+const connIdleTimeout = time.Minute
+
+// connPool keeps one long-lived gRPC connection per remote address, so the
+// maintenance loops do not pay for a dial and a TLS handshake on every call
+type connPool struct {
+	mu    sync.Mutex
+	creds credentials.TransportCredentials
+	conns map[string]*pooledConn
+
+	idleTimeout time.Duration
+	done        chan struct{}
+}
+
+type pooledConn struct {
+	conn     *grpc.ClientConn
+	client   pb.ChordClient
+	lastUsed time.Time
+	calls    int // in flight, which keep the connection from being reaped
+}
+
+// newConnPool dials with creds and starts the idle reaper
+func newConnPool(creds credentials.TransportCredentials, idleTimeout time.Duration) *connPool {
+	p := &connPool{
+		creds:       creds,
+		conns:       make(map[string]*pooledConn),
+		idleTimeout: idleTimeout,
+		done:        make(chan struct{}),
+	}
+	go p.reapIdle()
+	return p
+}
+
+// get returns the connection to address, dialing lazily, for one call that
+// must be handed back with release. gRPC reconnects a broken connection by
+// itself; only one that has failed and is not used by any call is thrown
+// away and dialed again, so we do not wait out its reconnect backoff.
+func (p *connPool) get(address string) (*pooledConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pc, ok := p.conns[address]; ok {
+		state := pc.conn.GetState()
+		failed := state == connectivity.TransientFailure || state == connectivity.Shutdown
+		if !failed || pc.calls > 0 {
+			pc.calls++
+			pc.lastUsed = time.Now()
+			return pc, nil
+		}
+		pc.conn.Close()
+		delete(p.conns, address)
+	}
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(p.creds))
+	if err != nil {
+		return nil, err
+	}
+	pc := &pooledConn{conn: conn, client: pb.NewChordClient(conn), lastUsed: time.Now(), calls: 1}
+	p.conns[address] = pc
+	return pc, nil
+}
+
+// release hands back a connection after a call on it ended
+func (p *connPool) release(pc *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc.calls--
+	pc.lastUsed = time.Now()
+}
+
+// reapIdle closes connections that no call has used for a while
+func (p *connPool) reapIdle() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		for address, pc := range p.conns {
+			if pc.calls == 0 && time.Since(pc.lastUsed) > p.idleTimeout {
+				//log.Printf("pool: closing idle connection to %s", address)
+				pc.conn.Close()
+				delete(p.conns, address)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// close shuts down every pooled connection
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	close(p.done)
+	for address, pc := range p.conns {
+		if err := pc.conn.Close(); err != nil {
+			log.Printf("pool: closing connection to %s: %v", address, err)
+		}
+		delete(p.conns, address)
+	}
+}
@@ -0,0 +1,43 @@
+package chord
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestPoolKeepsConnectionsInUse(t *testing.T) {
+	p := newConnPool(insecure.NewCredentials(), 50*time.Millisecond)
+	defer p.close()
+	pooled := func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		_, ok := p.conns["127.0.0.1:1"]
+		return ok
+	}
+
+	// a long call, like a stream, outlives the idle timeout
+	pc, err := p.get("127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if !pooled() {
+		t.Fatal("connection was reaped during a call")
+	}
+
+	// and the connection only counts as idle from when it ended
+	p.release(pc)
+	time.Sleep(5 * time.Millisecond)
+	if !pooled() {
+		t.Fatal("connection was reaped right after a call ended")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for pooled() {
+		if time.Now().After(deadline) {
+			t.Fatal("idle connection was never reaped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,210 @@
+package chord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// a key lives on the node responsible for it and the next ones after it
+	defaultReplicas = 3
+	// by default one answer is enough, as in the days before quorums
+	defaultReadQuorum  = 1
+	defaultWriteQuorum = 1
+)
+
+// errNoQuorum is wrapped into the error of a read or write that too few
+// replicas answered
+var errNoQuorum = errors.New("quorum not reached")
+
+// Replica is how one replica answered a quorum read or write
+type Replica struct {
+	Node NodeRef
+	Err  error
+
+	// what a read found; Found includes tombstones
+	Item  Item
+	Found bool
+}
+
+// QuorumResult lists the replicas of a key and how each of them answered
+type QuorumResult struct {
+	Owner    NodeRef
+	Replicas []Replica
+}
+
+// Answered returns the replicas that answered without error
+func (q QuorumResult) Answered() []NodeRef {
+	var refs []NodeRef
+	for _, r := range q.Replicas {
+		if r.Err == nil {
+			refs = append(refs, r.Node)
+		}
+	}
+	return refs
+}
+
+// ReadResult is the newest version a quorum read found
+type ReadResult struct {
+	QuorumResult
+	Item  Item
+	Found bool // false if no replica had the key, or the newest version is a delete
+}
+
+// replicaSet returns the nodes that should hold key: the node responsible
+// for it followed by its successors, n.Replicas nodes at most
+func (n *Node) replicaSet(ctx context.Context, key string) (NodeRef, []NodeRef, error) {
+	nb, err := n.ownerOf(ctx, hash(key))
+	if err != nil {
+		return nb.Self, nil, err
+	}
+	owner := nb.Self
+	replicas := []NodeRef{owner}
+	for _, succ := range nb.Successors {
+		if len(replicas) >= n.Replicas {
+			break
+		}
+		if succ.IsZero() || succ.Address == owner.Address {
+			// the successor list wrapped around: the ring is smaller than N
+			break
+		}
+		replicas = append(replicas, succ)
+	}
+	return owner, replicas, nil
+}
+
+// ownerOf returns the node responsible for id with its neighbours. A node
+// in the ring finds it itself, a Client asks the ring.
+func (n *Node) ownerOf(ctx context.Context, id *big.Int) (Neighbours, error) {
+	if n.ring != nil {
+		return n.ring.find(ctx, id)
+	}
+	resp, err := n.FindSuccessor(ctx, &pb.FindSuccessorRequest{Id: id.Bytes()})
+	if err != nil {
+		return Neighbours{}, fmt.Errorf("failed to lookup node for key: %v", err)
+	}
+	owner := newNodeRef(resp.Adress, resp.Identifier)
+	nb, err := n.getPredecessorOf(ctx, owner)
+	if err != nil {
+		return Neighbours{Self: owner}, fmt.Errorf("failed to get successors of %s: %v", owner.Address, err)
+	}
+	return nb, nil
+}
+
+// write stores a new version of key on its replicas, and deletes it if
+// deleted is set. The write is conditional on expected; without one, the
+// current version is read first, so that of two writes racing each other
+// one fails with errConflict rather than being silently overwritten.
+// Conflicts are only reliably detected with W > N/2.
+func (n *Node) write(ctx context.Context, key string, value []byte, deleted bool, expected *Version) (QuorumResult, error) {
+	if expected == nil {
+		cur, err := n.readVersion(ctx, key)
+		if err != nil {
+			return cur.QuorumResult, err
+		}
+		expected = &cur.Item.Version
+	}
+	item := Item{Value: value, Deleted: deleted, Version: n.nextVersion(*expected)}
+	return n.replicate(ctx, key, item, expected)
+}
+
+// replicate writes item to every replica of key, and succeeds if at least
+// n.WriteQuorum of them acknowledge it. expected is passed on to pushItem.
+func (n *Node) replicate(ctx context.Context, key string, item Item, expected *Version) (QuorumResult, error) {
+	owner, replicas, err := n.replicaSet(ctx, key)
+	if err != nil {
+		return QuorumResult{Owner: owner}, err
+	}
+	res := QuorumResult{Owner: owner, Replicas: make([]Replica, len(replicas))}
+	var wg sync.WaitGroup
+	for i, ref := range replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res.Replicas[i] = Replica{Node: ref, Err: n.pushItem(ctx, ref.Address, key, item, expected)}
+		}()
+	}
+	wg.Wait()
+	if acked := len(res.Answered()); acked < n.WriteQuorum {
+		for _, r := range res.Replicas {
+			if status.Code(r.Err) == codes.FailedPrecondition {
+				return res, fmt.Errorf("%w: %d of %d replicas hold a newer version than %s", errConflict, len(replicas)-acked, len(replicas), expected)
+			}
+		}
+		return res, fmt.Errorf("%w: %d of %d replicas acknowledged the write, %d needed", errNoQuorum, acked, len(replicas), n.WriteQuorum)
+	}
+	return res, nil
+}
+
+// read asks the first n.ReadQuorum replicas of key for it, the node
+// responsible for it first, and the next replica for each one that fails.
+// It returns the newest version among the answers.
+func (n *Node) read(ctx context.Context, key string) (ReadResult, error) {
+	return n.quorumRead(ctx, key, Peer.Get)
+}
+
+// readVersion is read without the value, for callers that only need to
+// know whether key is there and at which version
+func (n *Node) readVersion(ctx context.Context, key string) (ReadResult, error) {
+	return n.quorumRead(ctx, key, Peer.Head)
+}
+
+// quorumRead is read, asking each replica with get
+func (n *Node) quorumRead(ctx context.Context, key string, get func(Peer, context.Context, string) (Item, bool, error)) (ReadResult, error) {
+	owner, replicas, err := n.replicaSet(ctx, key)
+	if err != nil {
+		return ReadResult{QuorumResult: QuorumResult{Owner: owner}}, err
+	}
+	// the replicas that have not answered once we have a quorum are cut off
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replies := make(chan Replica, len(replicas))
+	next, pending := 0, 0
+	ask := func() {
+		ref := replicas[next]
+		next++
+		pending++
+		go func() {
+			item, found, err := get(n.peer(ref.Address), ctx, key)
+			replies <- Replica{Node: ref, Err: err, Item: item, Found: found}
+		}()
+	}
+	for next < len(replicas) && next < n.ReadQuorum {
+		ask()
+	}
+
+	res := ReadResult{QuorumResult: QuorumResult{Owner: owner}}
+	answered := 0
+	newest := -1
+	for pending > 0 && answered < n.ReadQuorum {
+		r := <-replies
+		pending--
+		res.Replicas = append(res.Replicas, r)
+		if r.Err != nil {
+			if next < len(replicas) {
+				ask()
+			}
+			continue
+		}
+		answered++
+		if r.Found && (newest < 0 || res.Replicas[newest].Item.Version.Less(r.Item.Version)) {
+			newest = len(res.Replicas) - 1
+		}
+	}
+	if answered < n.ReadQuorum {
+		return res, fmt.Errorf("%w: %d of %d replicas answered the read, %d needed", errNoQuorum, answered, len(replicas), n.ReadQuorum)
+	}
+	if newest >= 0 {
+		res.Item = res.Replicas[newest].Item
+		res.Found = !res.Item.Deleted
+	}
+	return res, nil
+}
@@ -0,0 +1,222 @@
+package chord
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// replicaCheckInterval is how often maintainReplicas looks for keys to hand
+// back even if our neighbours did not change. Whether we still hold a
+// replica of somebody else's key depends on nodes further back in the
+// ring than our predecessor, and we do not notice when they change.
+const replicaCheckInterval = time.Minute
+
+// maintainReplicas keeps the replicas of our keys where they belong. When
+// our predecessor or the successors holding our replicas change, it
+// pushes the keys we are responsible for to the successors that do not
+// have them yet, and hands back the replicas of other nodes' keys we no
+// longer have to hold. The check every replicaCheckInterval only hands
+// back; a replica that lost a key while nothing changed is repaired by
+// anti-entropy. It is cheap when nothing changed, so it runs as often as
+// stabilize.
+func (n *Node) maintainReplicas(ctx context.Context) {
+	n.letGo(ctx)
+	nb := n.neighbours()
+	if nb.Predecessor.IsZero() {
+		// we do not know where our range starts
+		return
+	}
+	holders := replicaHolders(nb, n.Replicas)
+
+	n.replicaMu.Lock()
+	changed := nb.Predecessor.Address != n.replicaPred || !slices.Equal(holders, n.replicaHolders)
+	due := time.Since(n.replicasChecked) >= replicaCheckInterval
+	known := n.replicaHolders
+	if nb.Predecessor.Address != n.replicaPred {
+		// our range changed, so the holders may lack some of our keys
+		known = nil
+	}
+	n.replicaMu.Unlock()
+	if !changed && !due {
+		return
+	}
+
+	if n.syncReplicas(ctx, nb, holders, known) {
+		n.replicaMu.Lock()
+		n.replicaPred = nb.Predecessor.Address
+		n.replicaHolders = holders
+		n.replicasChecked = time.Now()
+		n.replicaMu.Unlock()
+	}
+}
+
+// keyRange is the part of the ring in (start, end]
+type keyRange struct {
+	start, end *big.Int
+}
+
+// releaseRange notes that we are no longer responsible for the keys in
+// (start, end], because a node joined in between and took them over. The
+// next maintainReplicas lets go of them.
+func (n *Node) releaseRange(start, end *big.Int) {
+	n.replicaMu.Lock()
+	n.released = append(n.released, keyRange{start, end})
+	n.replicaMu.Unlock()
+}
+
+// letGo hands back the keys of the ranges we released, dropping those we
+// are not a replica of. Ranges that did not go through are tried again
+// next time.
+func (n *Node) letGo(ctx context.Context) {
+	n.replicaMu.Lock()
+	released := n.released
+	n.released = nil
+	n.replicaMu.Unlock()
+	if len(released) == 0 {
+		return
+	}
+
+	keys, err := n.keys(func(k string) bool {
+		return slices.ContainsFunc(released, func(r keyRange) bool { return between(r.start, hash(k), r.end, true) })
+	})
+	if err != nil {
+		log.Printf("replicas: failed to read our keys: %v", err)
+	}
+	failed, dropped := err != nil, 0
+	for _, k := range keys {
+		if failed {
+			break
+		}
+		ok, err := n.handBack(ctx, k)
+		if err != nil {
+			log.Printf("replicas: %s: %v", k, err)
+			failed = true
+		} else if ok {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		log.Printf("replicas: dropped %d keys our new predecessor took over", dropped)
+	}
+	if failed {
+		n.replicaMu.Lock()
+		n.released = append(released, n.released...)
+		n.replicaMu.Unlock()
+	}
+}
+
+// replicaHolders returns the addresses of the successors that hold the
+// replicas of our keys
+func replicaHolders(nb Neighbours, replicas int) []string {
+	var holders []string
+	for _, succ := range nb.Successors {
+		if len(holders) >= replicas-1 || succ.Address == nb.Self.Address {
+			break
+		}
+		holders = append(holders, succ.Address)
+	}
+	return holders
+}
+
+// syncReplicas pushes our keys to the holders that are not in known and
+// lack them, and hands back the keys of other nodes that we are no longer
+// a replica of.
+// It reports whether everything went through; if not, maintainReplicas
+// tries again on its next run.
+func (n *Node) syncReplicas(ctx context.Context, nb Neighbours, holders []string, known []string) bool {
+	keys, err := n.keys(func(string) bool { return true })
+	if err != nil {
+		log.Printf("replicas: failed to read our keys: %v", err)
+		return false
+	}
+	pushed, dropped, failed := 0, 0, 0
+	for _, k := range keys {
+		if ctx.Err() != nil {
+			return false
+		}
+		if between(nb.Predecessor.Identifier, hash(k), nb.Self.Identifier, true) {
+			for _, h := range holders {
+				if slices.Contains(known, h) {
+					continue
+				}
+				copied, err := n.pushIfOlder(ctx, h, k)
+				if err != nil {
+					log.Printf("replicas: failed to copy %s to %s: %v", k, h, err)
+					failed++
+					continue
+				}
+				if copied {
+					pushed++
+				}
+			}
+			continue
+		}
+		ok, err := n.handBack(ctx, k)
+		if err != nil {
+			log.Printf("replicas: %s: %v", k, err)
+			failed++
+			continue
+		}
+		if ok {
+			dropped++
+		}
+	}
+	if pushed > 0 || dropped > 0 || failed > 0 {
+		log.Printf("replicas: copied %d items to %d successors, dropped %d keys, %d failed", pushed, len(holders), dropped, failed)
+	}
+	return failed == 0
+}
+
+// pushIfOlder sends our version of key to the node at address, unless it
+// already has that version or a newer one. It reports whether it sent it.
+func (n *Node) pushIfOlder(ctx context.Context, address string, key string) (bool, error) {
+	item, ok, err := n.Bucket.Get(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	theirs, found, err := n.peer(address).Head(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if found && !theirs.Version.Less(item.Version) {
+		return false, nil
+	}
+	return true, n.pushItem(ctx, address, key, item, nil)
+}
+
+// handBack drops our copy of somebody else's key if we are no longer one
+// of its replicas. The copy is pushed to the replicas first, in case we
+// are the last node that has it, and only dropped if all of them took it
+// and nobody wrote the key in the meantime.
+func (n *Node) handBack(ctx context.Context, key string) (bool, error) {
+	_, replicas, err := n.replicaSet(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	for _, ref := range replicas {
+		if ref.Address == n.Address {
+			return false, nil
+		}
+	}
+	item, ok, err := n.Bucket.Get(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	for _, ref := range replicas {
+		if err := n.pushItem(ctx, ref.Address, key, item, nil); err != nil {
+			return false, err
+		}
+	}
+
+	n.bucketMu.Lock()
+	defer n.bucketMu.Unlock()
+	cur, ok, err := n.Bucket.Get(key)
+	if err != nil || !ok || cur.Version != item.Version {
+		return false, err
+	}
+	defer n.bucketGen.Add(1)
+	return true, n.Bucket.Delete(key)
+}
@@ -0,0 +1,356 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const envelopeMagic = "chord-envelope 1\n"
+
+// envelope is what StoreFile stores under the name of a file. The chunks
+// are encrypted with a random data key, and the envelope holds that key
+// sealed with the password and wrapped for everybody the file is shared
+// with, so that sharing a file or taking it back only rewrites the
+// envelope, not the file.
+type envelope struct {
+	// the data key, sealed with the password
+	Password []byte `json:"password"`
+	// the data key, for the holders of some X25519 keys
+	Recipients []recipient `json:"recipients,omitempty"`
+	// the chunks of the file, encrypted with the data key
+	Manifest *manifest `json:"manifest,omitempty"`
+	// or, for a file stored by content, its index record sealed with the
+	// data key
+	Index []byte `json:"index,omitempty"`
+}
+
+// recipient is the data key of a file wrapped for the holder of an X25519
+// key: sealed with a key both sides can derive, from an ephemeral key of
+// ours and their public key, or from their private key and our ephemeral
+// public key
+type recipient struct {
+	PublicKey []byte `json:"public_key"`
+	Ephemeral []byte `json:"ephemeral"`
+	Key       []byte `json:"key"`
+}
+
+func (e envelope) encode() []byte {
+	data, _ := json.Marshal(e)
+	return append([]byte(envelopeMagic), data...)
+}
+
+// parseEnvelope reads the envelope stored under a file name. It returns
+// false for a file stored before envelopes.
+func parseEnvelope(value []byte) (envelope, bool, error) {
+	var e envelope
+	data, ok := bytes.CutPrefix(value, []byte(envelopeMagic))
+	if !ok {
+		return e, false, nil
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, false, fmt.Errorf("invalid envelope: %v", err)
+	}
+	return e, true, nil
+}
+
+// seal puts the data key of the file name in the envelope, for the
+// password and for recipients
+func (e *envelope) seal(dataKey []byte, name string, keys *keyring, recipients []*ecdh.PublicKey) error {
+	var err error
+	if e.Password, err = keys.seal(dataKey, name); err != nil {
+		return err
+	}
+	e.Recipients = nil
+	for _, pub := range recipients {
+		r, err := wrapKey(dataKey, pub, name)
+		if err != nil {
+			return err
+		}
+		e.Recipients = append(e.Recipients, r)
+	}
+	return nil
+}
+
+// open returns the data key of the file name, with the password if there
+// is one, or else as one of the recipients with identity
+func (e envelope) open(name string, keys *keyring, identity *ecdh.PrivateKey) ([]byte, error) {
+	var err error
+	if keys.password != "" {
+		var dataKey []byte
+		if dataKey, err = keys.open(e.Password, name); err == nil {
+			return dataKey, nil
+		}
+	}
+	if identity != nil {
+		pub := identity.PublicKey().Bytes()
+		for _, r := range e.Recipients {
+			if bytes.Equal(r.PublicKey, pub) {
+				return unwrapKey(r, identity, name)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: the file is not shared with us", errDecrypt)
+}
+
+// recipientKeys returns the public keys the envelope is shared with. A key
+// that does not parse fails it, rather than dropping that recipient.
+func (e envelope) recipientKeys() ([]*ecdh.PublicKey, error) {
+	var keys []*ecdh.PublicKey
+	for i, r := range e.Recipients {
+		pub, err := ecdh.X25519().NewPublicKey(r.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid envelope: recipient %d: %v", i, err)
+		}
+		keys = append(keys, pub)
+	}
+	return keys, nil
+}
+
+// wrapKey wraps the data key of the file name for the holder of pub
+func wrapKey(dataKey []byte, pub *ecdh.PublicKey, name string) (recipient, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return recipient{}, fmt.Errorf("failed to generate key: %v", err)
+	}
+	shared, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return recipient{}, err
+	}
+	r := recipient{PublicKey: pub.Bytes(), Ephemeral: ephemeral.PublicKey().Bytes()}
+	kek, err := wrappingKey(shared, r)
+	if err != nil {
+		return recipient{}, err
+	}
+	r.Key, err = newDataKeyring(kek).seal(dataKey, name)
+	return r, err
+}
+
+func unwrapKey(r recipient, identity *ecdh.PrivateKey, name string) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().NewPublicKey(r.Ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %v", err)
+	}
+	shared, err := identity.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := wrappingKey(shared, r)
+	if err != nil {
+		return nil, err
+	}
+	return newDataKeyring(kek).open(r.Key, name)
+}
+
+// wrappingKey derives the key a data key is wrapped with from the secret
+// shared with a recipient
+func wrappingKey(shared []byte, r recipient) ([]byte, error) {
+	salt := append(append([]byte{}, r.Ephemeral...), r.PublicKey...)
+	return hkdf.Key(sha256.New, shared, salt, "chord file key", dataKeySize)
+}
+
+// ParsePublicKey reads an X25519 public key as PublicKeyString prints it
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	return pub, nil
+}
+
+func PublicKeyString(pub *ecdh.PublicKey) string {
+	return hex.EncodeToString(pub.Bytes())
+}
+
+// LoadIdentity reads the X25519 private key in the file at path, creating
+// a new one if there is no such file
+func LoadIdentity(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Bytes())+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+// parsePrivateKey reads an X25519 private key as an identity file holds it
+func parsePrivateKey(s string) (*ecdh.PrivateKey, error) {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	return key, nil
+}
+
+// openFile opens the envelope stored under a file name, returning it and
+// the data key inside. Without an identity only the password opens it.
+func openFile(value []byte, name string, keys *keyring, identity *ecdh.PrivateKey) (envelope, []byte, error) {
+	e, ok, err := parseEnvelope(value)
+	if err != nil {
+		return e, nil, err
+	}
+	if !ok {
+		return e, nil, fmt.Errorf("%s was stored before files could be shared; store it again", name)
+	}
+	dataKey, err := e.open(name, keys, identity)
+	return e, dataKey, err
+}
+
+// ShareFile lets the holder of the private key for pub read filename
+// without knowing its password. Only the password can share a file.
+func (n *Node) ShareFile(ctx context.Context, filename string, password string, pub *ecdh.PublicKey) (QuorumResult, error) {
+	key := n.fileKey(filename)
+	cur, err := n.read(ctx, key)
+	if err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to share file: %w", err)
+	}
+	if !cur.Found || cur.Item.Deleted {
+		return cur.QuorumResult, fmt.Errorf("failed to share file: %s not found", filename)
+	}
+	keys := newKeyring(password)
+	e, dataKey, err := openFile(cur.Item.Value, filename, keys, nil)
+	if err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to share file: %w", err)
+	}
+	recipients, err := e.recipientKeys()
+	if err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to share file: %w", err)
+	}
+	if slices.ContainsFunc(recipients, func(k *ecdh.PublicKey) bool { return k.Equal(pub) }) {
+		return cur.QuorumResult, nil
+	}
+	if err := e.seal(dataKey, filename, keys, append(recipients, pub)); err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to share file: %w", err)
+	}
+	res, err := n.write(ctx, key, e.encode(), false, &cur.Item.Version)
+	if err != nil {
+		return res, fmt.Errorf("failed to share file: %w", err)
+	}
+	return res, nil
+}
+
+// RevokeFile stops sharing filename with the holder of the private key for
+// pub. They may have kept the data key, so the file is encrypted again
+// with a new one for the password and the remaining recipients. A file
+// stored by content is shared by everybody who stored the same content,
+// so only its index record gets the new key; whoever kept its content
+// reference can still read it.
+func (n *Node) RevokeFile(ctx context.Context, filename string, password string, pub *ecdh.PublicKey) (QuorumResult, error) {
+	key := n.fileKey(filename)
+	cur, err := n.read(ctx, key)
+	if err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to revoke file: %w", err)
+	}
+	if !cur.Found || cur.Item.Deleted {
+		return cur.QuorumResult, fmt.Errorf("failed to revoke file: %s not found", filename)
+	}
+	keys := newKeyring(password)
+	e, oldKey, err := openFile(cur.Item.Value, filename, keys, nil)
+	if err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to revoke file: %w", err)
+	}
+	recipients, err := e.recipientKeys()
+	if err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to revoke file: %w", err)
+	}
+	if !slices.ContainsFunc(recipients, func(k *ecdh.PublicKey) bool { return k.Equal(pub) }) {
+		return cur.QuorumResult, nil
+	}
+	recipients = slices.DeleteFunc(recipients, func(k *ecdh.PublicKey) bool { return k.Equal(pub) })
+
+	dataKey, err := newDataKey()
+	if err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to revoke file: %w", err)
+	}
+	old, data := newDataKeyring(oldKey), newDataKeyring(dataKey)
+	if e.Index != nil {
+		index, err := old.open(e.Index, filename)
+		if err == nil {
+			e.Index, err = data.seal(index, filename)
+		}
+		if err != nil {
+			return cur.QuorumResult, fmt.Errorf("failed to revoke file: %w", err)
+		}
+	}
+	if e.Manifest != nil {
+		m, err := n.reencryptChunks(ctx, *e.Manifest, filename, old, data)
+		if err != nil {
+			return cur.QuorumResult, fmt.Errorf("failed to revoke file: %w", err)
+		}
+		e.Manifest = &m
+	}
+	if err := e.seal(dataKey, filename, keys, recipients); err != nil {
+		return cur.QuorumResult, fmt.Errorf("failed to revoke file: %w", err)
+	}
+	res, err := n.write(ctx, key, e.encode(), false, &cur.Item.Version)
+	if err != nil {
+		return res, fmt.Errorf("failed to revoke file: %w", err)
+	}
+	n.dropChunks(ctx, cur.Item)
+	return res, nil
+}
+
+// reencryptChunks stores the chunks of the file name that m lists again,
+// encrypted with the keys of data instead of old
+func (n *Node) reencryptChunks(ctx context.Context, m manifest, name string, old, data *keyring) (manifest, error) {
+	out := manifest{Size: m.Size}
+	if m.Checksum != nil {
+		sum, err := old.open(m.Checksum, checksumAAD(name))
+		if err == nil {
+			out.Checksum, err = data.seal(sum, checksumAAD(name))
+		}
+		if err != nil {
+			return manifest{}, err
+		}
+	}
+	for i, ref := range m.Chunks {
+		chunk, err := n.fetchChunk(ctx, ref, old, chunkAAD(name, i))
+		if err != nil {
+			return manifest{}, err
+		}
+		sealed, err := data.seal(chunk, chunkAAD(name, i))
+		if err != nil {
+			return manifest{}, err
+		}
+		ref = chunkRef{Key: chunkKey(sealed), Size: len(sealed)}
+		if err := n.storeChunk(ctx, ref.Key, sealed, Version{}); err != nil {
+			return manifest{}, err
+		}
+		out.Chunks = append(out.Chunks, ref)
+	}
+	return out, nil
+}
@@ -0,0 +1,134 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+func newIdentity(t *testing.T) *ecdh.PrivateKey {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestShareAndRevoke(t *testing.T) {
+	r := newTestRing(t, 6)
+	ctx := context.Background()
+	owner, bob, carol := r.nodes[1], r.nodes[3], r.nodes[4]
+	owner.ChunkSize = 1 << 10
+	bob.Identity, carol.Identity = newIdentity(t), newIdentity(t)
+	data := randomData(8, 5<<10)
+	file := writeTestFile(t, "team.bin", data)
+	if _, err := owner.StoreFile(ctx, file, "pw"); err != nil {
+		t.Fatal(err)
+	}
+	canRead := func(n *Node, want []byte) {
+		t.Helper()
+		if got, _, err := n.LookupFile(ctx, "team.bin", ""); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: LookupFile = %d bytes, %v; want %d", n.Address, len(got), err, len(want))
+		}
+	}
+	cannotRead := func(n *Node) {
+		t.Helper()
+		if _, _, err := n.LookupFile(ctx, "team.bin", ""); err == nil {
+			t.Errorf("%s can read a file not shared with it", n.Address)
+		}
+	}
+	cannotRead(bob)
+
+	if _, err := owner.ShareFile(ctx, "team.bin", "wrong", bob.Identity.PublicKey()); err == nil {
+		t.Fatal("ShareFile with the wrong password succeeded")
+	}
+	for _, n := range []*Node{bob, carol} {
+		if _, err := owner.ShareFile(ctx, "team.bin", "pw", n.Identity.PublicKey()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	canRead(bob, data)
+	canRead(carol, data)
+	if got, _, err := owner.LookupFile(ctx, "team.bin", "pw"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("the owner cannot read the shared file: %v", err)
+	}
+
+	// bob may have kept the data key, so the chunks are encrypted again
+	old := manifestOf(t, owner, "team.bin")
+	if _, err := owner.RevokeFile(ctx, "team.bin", "pw", bob.Identity.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	cannotRead(bob)
+	canRead(carol, data)
+	for i, ref := range manifestOf(t, owner, "team.bin").Chunks {
+		if ref.Key == old.Chunks[i].Key {
+			t.Errorf("chunk %d was not encrypted again", i)
+		}
+		if item, ok, _ := r.owner(hash(old.Chunks[i].Key)).Bucket.Get(old.Chunks[i].Key); !ok || !item.Deleted {
+			t.Errorf("old chunk %d was not deleted", i)
+		}
+	}
+
+	// a new version of the file stays shared
+	data = randomData(9, 3<<10)
+	if _, err := owner.StoreFile(ctx, writeTestFile(t, "team.bin", data), "pw"); err != nil {
+		t.Fatal(err)
+	}
+	canRead(carol, data)
+	cannotRead(bob)
+}
+
+func TestRevokeComparesRecipientKeys(t *testing.T) {
+	r := newTestRing(t, 4)
+	ctx := context.Background()
+	owner := r.nodes[0]
+	if _, err := owner.StoreFile(ctx, writeTestFile(t, "keys.txt", []byte("keys")), "pw"); err != nil {
+		t.Fatal(err)
+	}
+	bob := newIdentity(t)
+	if _, err := owner.ShareFile(ctx, "keys.txt", "pw", bob.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	key := owner.fileKey("keys.txt")
+	version := func() Version {
+		t.Helper()
+		cur, err := owner.read(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cur.Item.Version
+	}
+
+	// revoking somebody the file is not shared with changes nothing
+	before := version()
+	if _, err := owner.RevokeFile(ctx, "keys.txt", "pw", newIdentity(t).PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	if version() != before {
+		t.Error("revoking a key the file is not shared with wrote a new version")
+	}
+
+	// a recipient whose key does not parse is not silently dropped
+	cur, err := owner.read(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _, err := parseEnvelope(cur.Item.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Recipients = append(e.Recipients, recipient{PublicKey: []byte("not a key")})
+	if _, err := owner.write(ctx, key, e.encode(), false, &cur.Item.Version); err != nil {
+		t.Fatal(err)
+	}
+	before = version()
+	if _, err := owner.RevokeFile(ctx, "keys.txt", "pw", bob.PublicKey()); err == nil {
+		t.Error("RevokeFile ignored a recipient key that does not parse")
+	}
+	if version() != before {
+		t.Error("a failed revoke wrote a new version")
+	}
+}
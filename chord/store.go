@@ -0,0 +1,334 @@
+package chord
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store holds the items of a node. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Get returns the item under key, tombstones included
+	Get(key string) (Item, bool, error)
+	Put(key string, item Item) error
+	// Delete forgets key entirely, without leaving a tombstone. It is for
+	// keys that moved to other nodes, not for deleting files.
+	Delete(key string) error
+	// Range calls fn for every item until fn returns false
+	Range(fn func(key string, item Item) bool) error
+	// RangeKeys is Range without reading the values: the items fn gets
+	// only have their version and whether they are deleted
+	RangeKeys(fn func(key string, item Item) bool) error
+	Close() error
+}
+
+// memStore keeps everything in a map and forgets it when the node stops
+type memStore struct {
+	mu    sync.RWMutex
+	items map[string]Item
+}
+
+func newMemStore() *memStore {
+	return &memStore{items: make(map[string]Item)}
+}
+
+func (s *memStore) Get(key string) (Item, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, ok := s.items[key]
+	return item, ok, nil
+}
+
+func (s *memStore) Put(key string, item Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = item
+	return nil
+}
+
+func (s *memStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, key)
+	return nil
+}
+
+func (s *memStore) Range(fn func(key string, item Item) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k, item := range s.items {
+		if !fn(k, item) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memStore) RangeKeys(fn func(key string, item Item) bool) error {
+	return s.Range(func(k string, item Item) bool {
+		return fn(k, Item{Version: item.Version, Deleted: item.Deleted})
+	})
+}
+
+func (s *memStore) Close() error {
+	return nil
+}
+
+// fileStore keeps one file per key in a directory. Every write goes to a
+// temporary file that is synced and renamed over the old one, so a crash
+// leaves either the old or the new item behind, never half of one.
+type fileStore struct {
+	mu   sync.RWMutex
+	dir  string
+	keys map[string]bool
+}
+
+// item file layout: format version, flags, clock, key length, writer
+// length, writer, key, value
+const (
+	itemFileVersion = 1
+	itemHeaderSize  = 1 + 1 + 8 + 4 + 2
+	itemDeleted     = 1 << 0
+	tmpPrefix       = ".tmp-"
+)
+
+// NewFileStore returns a Store that keeps one file per key in dir, so that
+// the items survive a restart
+func NewFileStore(dir string) (Store, error) {
+	return newFileStore(dir)
+}
+
+// newFileStore opens the store in dir, creating it if needed, and finds
+// the items it already holds
+func newFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileStore{dir: dir, keys: make(map[string]bool)}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+		// left over from a write that never finished
+		if strings.HasPrefix(name, tmpPrefix) {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		key, _, err := readItemHeader(filepath.Join(dir, name))
+		if err != nil {
+			log.Printf("store: skipping %s: %v", name, err)
+			continue
+		}
+		s.keys[key] = true
+	}
+	return s, nil
+}
+
+// path returns where the item for key lives. Keys are file names chosen by
+// users, so they are hashed rather than used as paths.
+func (s *fileStore) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *fileStore) Get(key string) (Item, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.keys[key] {
+		return Item{}, false, nil
+	}
+	_, item, err := readItemFile(s.path(key))
+	if err != nil {
+		return Item{}, false, err
+	}
+	return item, true, nil
+}
+
+func (s *fileStore) Put(key string, item Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileSync(s.dir, s.path(key), encodeItem(key, item)); err != nil {
+		return err
+	}
+	s.keys[key] = true
+	return nil
+}
+
+func (s *fileStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.keys[key] {
+		return nil
+	}
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.keys, key)
+	return nil
+}
+
+func (s *fileStore) Range(fn func(key string, item Item) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key := range s.keys {
+		_, item, err := readItemFile(s.path(key))
+		if err != nil {
+			return err
+		}
+		if !fn(key, item) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) RangeKeys(fn func(key string, item Item) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key := range s.keys {
+		_, item, err := readItemHeader(s.path(key))
+		if err != nil {
+			return err
+		}
+		if !fn(key, item) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+func encodeItem(key string, item Item) []byte {
+	writer := item.Version.Writer
+	buf := make([]byte, itemHeaderSize, itemHeaderSize+len(writer)+len(key)+len(item.Value))
+	buf[0] = itemFileVersion
+	if item.Deleted {
+		buf[1] |= itemDeleted
+	}
+	binary.BigEndian.PutUint64(buf[2:], item.Version.Clock)
+	binary.BigEndian.PutUint32(buf[10:], uint32(len(key)))
+	binary.BigEndian.PutUint16(buf[14:], uint16(len(writer)))
+	buf = append(buf, writer...)
+	buf = append(buf, key...)
+	return append(buf, item.Value...)
+}
+
+func readItemFile(path string) (string, Item, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", Item{}, err
+	}
+	item, keyLen, writerLen, err := parseItemHeader(data)
+	if err != nil {
+		return "", Item{}, err
+	}
+	if len(data) < itemHeaderSize+writerLen+keyLen {
+		return "", Item{}, errors.New("item file too short")
+	}
+	item.Version.Writer = string(data[itemHeaderSize : itemHeaderSize+writerLen])
+	data = data[itemHeaderSize+writerLen:]
+	key := string(data[:keyLen])
+	if value := data[keyLen:]; len(value) > 0 {
+		item.Value = value
+	}
+	return key, item, nil
+}
+
+// readItemHeader reads the key, version and flags of the item file at
+// path, leaving the value on disk
+func readItemHeader(path string) (string, Item, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", Item{}, err
+	}
+	defer f.Close()
+	header := make([]byte, itemHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return "", Item{}, shortItemFile(err)
+	}
+	item, keyLen, writerLen, err := parseItemHeader(header)
+	if err != nil {
+		return "", Item{}, err
+	}
+	rest := make([]byte, writerLen+keyLen)
+	if _, err := io.ReadFull(f, rest); err != nil {
+		return "", Item{}, shortItemFile(err)
+	}
+	item.Version.Writer = string(rest[:writerLen])
+	return string(rest[writerLen:]), item, nil
+}
+
+// parseItemHeader reads the fixed size header at the start of an item
+// file, returning the item without its writer and the lengths of the
+// writer and key that follow
+func parseItemHeader(data []byte) (Item, int, int, error) {
+	if len(data) < itemHeaderSize {
+		return Item{}, 0, 0, errors.New("item file too short")
+	}
+	if data[0] != itemFileVersion {
+		return Item{}, 0, 0, fmt.Errorf("unknown item file version %d", data[0])
+	}
+	item := Item{
+		Version: Version{Clock: binary.BigEndian.Uint64(data[2:])},
+		Deleted: data[1]&itemDeleted != 0,
+	}
+	return item, int(binary.BigEndian.Uint32(data[10:])), int(binary.BigEndian.Uint16(data[14:])), nil
+}
+
+func shortItemFile(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errors.New("item file too short")
+	}
+	return err
+}
+
+// writeFileSync replaces path with data durably: data is synced before the
+// rename, and the directory after it
+func writeFileSync(dir, path string, data []byte) error {
+	f, err := os.CreateTemp(dir, tmpPrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
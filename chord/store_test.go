@@ -0,0 +1,97 @@
+package chord
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoreSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := map[string]Item{
+		"a.txt":       {Value: []byte("first"), Version: Version{Clock: 1}},
+		"../escape":   {Value: []byte("not a path"), Version: Version{Clock: 2}},
+		"deleted.txt": {Version: Version{Clock: 3}, Deleted: true},
+		"empty.txt":   {Version: Version{Clock: 4}},
+	}
+	for k, item := range items {
+		if err := s.Put(k, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put("a.txt", Item{Value: []byte("second"), Version: Version{Clock: 5, Writer: "b0b"}}); err != nil {
+		t.Fatal(err)
+	}
+	items["a.txt"] = Item{Value: []byte("second"), Version: Version{Clock: 5, Writer: "b0b"}}
+	s.Close()
+
+	// a write that was cut short must not show up
+	if err := os.WriteFile(filepath.Join(dir, tmpPrefix+"junk"), []byte{1, 2}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = newFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]Item)
+	if err := s.Range(func(k string, item Item) bool {
+		got[k] = item
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(items) {
+		t.Fatalf("reopened store has %d items, want %d", len(got), len(items))
+	}
+	for k, want := range items {
+		item, ok, err := s.Get(k)
+		if err != nil || !ok {
+			t.Fatalf("Get(%q) = %v, %v", k, ok, err)
+		}
+		if !bytes.Equal(item.Value, want.Value) || item.Version != want.Version || item.Deleted != want.Deleted {
+			t.Errorf("Get(%q) = %+v, want %+v", k, item, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, tmpPrefix+"junk")); !os.IsNotExist(err) {
+		t.Error("leftover temporary file was not cleaned up")
+	}
+}
+
+func TestRangeKeysLeavesOutValues(t *testing.T) {
+	files, err := newFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := map[string]Item{
+		"big":  {Value: randomData(3, 1<<20), Version: Version{Clock: 1, Writer: "a11ce"}},
+		"gone": {Version: Version{Clock: 2}, Deleted: true},
+	}
+	for _, s := range []Store{newMemStore(), files} {
+		for k, item := range items {
+			if err := s.Put(k, item); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := make(map[string]Item)
+		if err := s.RangeKeys(func(k string, item Item) bool {
+			got[k] = item
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(items) {
+			t.Fatalf("%T: RangeKeys gave %d keys, want %d", s, len(got), len(items))
+		}
+		for k, want := range items {
+			if item := got[k]; item.Value != nil || item.Version != want.Version || item.Deleted != want.Deleted {
+				t.Errorf("%T: RangeKeys gave %s at %s, deleted %v, with %d bytes; want %s, deleted %v, no value", s, k, item.Version, item.Deleted, len(item.Value), want.Version, want.Deleted)
+			}
+		}
+	}
+}
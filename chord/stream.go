@@ -0,0 +1,236 @@
+package chord
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// how much of a value goes into one frame of a stream
+	streamFrameSize = 64 << 10
+	// the largest value PutStream accepts, several times the chunk size
+	maxStreamedValue = 64 << 20
+)
+
+// PutStream implements the PutStream RPC method
+func (n *Node) PutStream(stream pb.Chord_PutStreamServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.Size < 0 || first.Size > maxStreamedValue {
+		return status.Errorf(codes.InvalidArgument, "value of %d bytes is over the limit of %d", first.Size, maxStreamedValue)
+	}
+	value := make([]byte, 0, first.Size)
+	for frame := first; ; {
+		if int64(len(value)+len(frame.Data)) > first.Size {
+			return status.Errorf(codes.InvalidArgument, "value is longer than the %d bytes announced", first.Size)
+		}
+		value = append(value, frame.Data...)
+		frame, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// the sender went away; nothing is stored
+			return err
+		}
+	}
+	if int64(len(value)) != first.Size {
+		return status.Errorf(codes.InvalidArgument, "stream ended after %d of %d bytes", len(value), first.Size)
+	}
+	item := Item{Value: value, Version: versionFromProto(first.Version)}
+	if _, err := n.store(first.Key, item, expectedFromProto(first.Expected)); err != nil {
+		return storeError("put", err)
+	}
+	return stream.SendAndClose(&pb.PutResponse{})
+}
+
+// GetStream implements the GetStream RPC method
+func (n *Node) GetStream(req *pb.GetStreamRequest, stream pb.Chord_GetStreamServer) error {
+	item, ok, err := n.Bucket.Get(req.Key)
+	if err != nil {
+		return fmt.Errorf("get: %v", err)
+	}
+	if !ok {
+		return stream.Send(&pb.GetStreamResponse{})
+	}
+	header := &pb.GetStreamResponse{
+		Found:   true,
+		Deleted: item.Deleted,
+		Version: item.Version.toProto(),
+		Size:    int64(len(item.Value)),
+	}
+	if req.Offset < 0 || req.Offset > header.Size {
+		return status.Errorf(codes.OutOfRange, "offset %d is outside a value of %d bytes", req.Offset, header.Size)
+	}
+	data := item.Value[req.Offset:]
+	frame := header
+	for {
+		frame.Data = data[:min(streamFrameSize, len(data))]
+		data = data[len(frame.Data):]
+		if err := stream.Send(frame); err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		frame = &pb.GetStreamResponse{}
+	}
+}
+
+// putStreamFrames cuts a PutStream into frames
+func putStreamFrames(key string, value []byte, version Version, expected *Version) []*pb.PutStreamRequest {
+	first := &pb.PutStreamRequest{
+		Key:      key,
+		Version:  version.toProto(),
+		Expected: expectedToProto(expected),
+		Size:     int64(len(value)),
+	}
+	first.Data = value[:min(streamFrameSize, len(value))]
+	value = value[len(first.Data):]
+	frames := []*pb.PutStreamRequest{first}
+	for len(value) > 0 {
+		frame := &pb.PutStreamRequest{Data: value[:min(streamFrameSize, len(value))]}
+		value = value[len(frame.Data):]
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// readGetStream reads the frames of a GetStream that started at offset,
+// writing the value to w. A stream that ends before the whole value
+// arrived fails with io.ErrUnexpectedEOF, after writing what did arrive.
+func readGetStream(recv func() (*pb.GetStreamResponse, error), offset int64, w io.Writer) (Item, bool, error) {
+	header, err := recv()
+	if err != nil {
+		return Item{}, false, err
+	}
+	item := Item{Version: versionFromProto(header.Version), Deleted: header.Deleted}
+	if !header.Found {
+		return item, false, nil
+	}
+	got := offset
+	for frame := header; ; {
+		if _, err := w.Write(frame.Data); err != nil {
+			return item, true, err
+		}
+		got += int64(len(frame.Data))
+		frame, err = recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return item, true, err
+		}
+	}
+	if got != header.Size {
+		return item, true, fmt.Errorf("got %d of %d bytes: %w", got, header.Size, io.ErrUnexpectedEOF)
+	}
+	return item, true, nil
+}
+
+// sendItems sends the items under keys in the frames of a GetAll: the
+// small ones in batches of about a frame, and each large one in frames of
+// its own. Each item is loaded as it is sent, nil for one that is gone.
+func sendItems(keys []string, load func(key string) (*pb.Item, error), send func(*pb.GetAllResponse) error) error {
+	batch, batchSize := &pb.GetAllResponse{}, 0
+	flush := func() error {
+		if len(batch.Items) == 0 {
+			return nil
+		}
+		err := send(batch)
+		batch, batchSize = &pb.GetAllResponse{}, 0
+		return err
+	}
+	for _, key := range keys {
+		item, err := load(key)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			continue
+		}
+		if len(item.Value) <= streamFrameSize {
+			batch.Items = append(batch.Items, item)
+			if batchSize += len(item.Key) + len(item.Value); batchSize >= streamFrameSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		value := item.Value
+		frame := &pb.GetAllResponse{
+			Items: []*pb.Item{{Key: item.Key, Version: item.Version}},
+			Size:  int64(len(value)),
+		}
+		for {
+			frame.Data = value[:min(streamFrameSize, len(value))]
+			value = value[len(frame.Data):]
+			if err := send(frame); err != nil {
+				return err
+			}
+			if len(value) == 0 {
+				break
+			}
+			frame = &pb.GetAllResponse{}
+		}
+	}
+	return flush()
+}
+
+// readItems reads the frames of a GetAll until the stream ends
+func readItems(recv func() (*pb.GetAllResponse, error)) (map[string]Item, error) {
+	items := make(map[string]Item)
+	var large string // the key of the large item whose value is arriving
+	var value []byte
+	var size int64
+	for {
+		frame, err := recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if large != "" && (len(frame.Items) > 0 || frame.Size != 0) {
+			return nil, fmt.Errorf("value of %s broke off after %d of %d bytes", large, len(value), size)
+		}
+		for k, item := range itemsFromProto(frame.Items) {
+			items[k] = item
+		}
+		if frame.Size != 0 {
+			if len(frame.Items) != 1 || frame.Size < 0 || frame.Size > maxStreamedValue {
+				return nil, fmt.Errorf("invalid frame for a value of %d bytes", frame.Size)
+			}
+			large, size, value = frame.Items[0].Key, frame.Size, make([]byte, 0, frame.Size)
+		}
+		if large == "" {
+			continue
+		}
+		if int64(len(value)+len(frame.Data)) > size {
+			return nil, fmt.Errorf("value of %s is longer than the %d bytes announced", large, size)
+		}
+		value = append(value, frame.Data...)
+		if int64(len(value)) == size {
+			item := items[large]
+			item.Value = value
+			items[large] = item
+			large = ""
+		}
+	}
+	if large != "" {
+		return nil, fmt.Errorf("value of %s: got %d of %d bytes: %w", large, len(value), size, io.ErrUnexpectedEOF)
+	}
+	return items, nil
+}
@@ -0,0 +1,191 @@
+package chord
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetStreamResumesAtOffset(t *testing.T) {
+	r := newTestRing(t, 2)
+	ctx := context.Background()
+	peer := r.transport.Peer(r.nodes[1].Address)
+	value := randomData(4, 200<<10)
+	if err := peer.PutStream(ctx, "big", value, Version{Clock: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	item, found, err := peer.GetStream(ctx, "big", 150000, &buf)
+	if err != nil || !found {
+		t.Fatalf("GetStream = found %v, %v", found, err)
+	}
+	if item.Version != (Version{Clock: 1}) || !bytes.Equal(buf.Bytes(), value[150000:]) {
+		t.Errorf("GetStream from an offset returned %d bytes at version %s", buf.Len(), item.Version)
+	}
+
+	// a stream that stops short is an error, not a short value
+	frames := []*pb.GetStreamResponse{{Found: true, Size: 10, Data: []byte("abcd")}}
+	recv := func() (*pb.GetStreamResponse, error) {
+		if len(frames) == 0 {
+			return nil, io.EOF
+		}
+		f := frames[0]
+		frames = frames[1:]
+		return f, nil
+	}
+	if _, _, err := readGetStream(recv, 0, io.Discard); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short stream: got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestStreamsCarryValuesOverMessageLimit(t *testing.T) {
+	ca := newTestCA(t)
+	server := serveTLS(t, ca.issue("server"))
+	transport, err := newGRPCTransport(ca.issue("client"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	ctx := context.Background()
+	peer := transport.Peer(server.Address)
+
+	// more than the 4 MB gRPC allows in one message
+	value := randomData(5, 5<<20)
+	if err := peer.Put(ctx, "big", value, Version{Clock: 1}, nil); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("unary Put of 5 MB: got %v, want ResourceExhausted", err)
+	}
+	if err := peer.PutStream(ctx, "big", value, Version{Clock: 1}, nil); err != nil {
+		t.Fatalf("PutStream: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, found, err := peer.GetStream(ctx, "big", 0, &buf); err != nil || !found || !bytes.Equal(buf.Bytes(), value) {
+		t.Fatalf("GetStream = %d bytes, found %v, %v", buf.Len(), found, err)
+	}
+}
+
+func TestHeadLeavesOutValue(t *testing.T) {
+	ca := newTestCA(t)
+	server := serveTLS(t, ca.issue("server"))
+	transport, err := newGRPCTransport(ca.issue("client"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	r := newTestRing(t, 2)
+	ctx := context.Background()
+
+	for _, peer := range []Peer{transport.Peer(server.Address), r.transport.Peer(r.nodes[1].Address)} {
+		if err := peer.Put(ctx, "chunk", randomData(8, 1<<20), Version{Clock: 4}, nil); err != nil {
+			t.Fatal(err)
+		}
+		item, found, err := peer.Head(ctx, "chunk")
+		if err != nil || !found || item.Version != (Version{Clock: 4}) || item.Value != nil {
+			t.Errorf("Head = %d bytes at version %s, found %v, %v; want only the version", len(item.Value), item.Version, found, err)
+		}
+		if _, found, err := peer.Head(ctx, "missing"); err != nil || found {
+			t.Errorf("Head of a missing key: found %v, %v", found, err)
+		}
+	}
+}
+
+func TestJoinTakesOverMoreThanAMessage(t *testing.T) {
+	ca := newTestCA(t)
+	first := startNode(t, ca.issue("first"))
+	defer first.Stop(context.Background())
+	files := ca.issue("second")
+	id, err := files.identifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// chunks, tombstones and a value larger than a message, all in the
+	// range the second node takes over, more than a message in all
+	want := make(map[string]Item)
+	ours := func(k string) bool { return between(first.id(), hash(k), id, true) }
+	for i := 0; len(want) < 64; i++ {
+		if key := fmt.Sprintf("chunk-%03d", i); ours(key) {
+			want[key] = Item{Value: randomData(int64(i), 128<<10), Version: Version{Clock: 1}}
+		}
+		if key := fmt.Sprintf("gone-%03d", i); ours(key) {
+			want[key] = Item{Deleted: true, Version: Version{Clock: 2}}
+		}
+	}
+	for i := 0; ; i++ {
+		if key := fmt.Sprintf("huge-%d", i); ours(key) {
+			want[key] = Item{Value: randomData(99, 5<<20), Version: Version{Clock: 3}}
+			break
+		}
+	}
+	for k, item := range want {
+		if err := first.Bucket.Put(k, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	second := startNode(t, files, first.Address)
+	defer second.Stop(context.Background())
+	for k, item := range want {
+		got, ok, err := second.Bucket.Get(k)
+		if err != nil || !ok || got.Version != item.Version || got.Deleted != item.Deleted || !bytes.Equal(got.Value, item.Value) {
+			t.Fatalf("%s was not taken over: found %v, %v", k, ok, err)
+		}
+	}
+}
+
+func TestListKeysLeavesOutValues(t *testing.T) {
+	r := newTestRing(t, 1)
+	ctx := context.Background()
+	data := randomData(6, 3*defaultChunkSize+7)
+	for _, name := range []string{"listed.bin", "kept.bin"} {
+		if _, err := r.nodes[0].StoreReader(ctx, name, bytes.NewReader(data), "pw"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.nodes[0].DeleteFile(ctx, "listed.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	ca := newTestCA(t)
+	server := serveTLS(t, ca.issue("server"))
+	transport, err := newGRPCTransport(ca.issue("client"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	all := 0
+	err = r.nodes[0].Bucket.Range(func(k string, item Item) bool {
+		all++
+		return server.Bucket.Put(k, item) == nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, peer := range []Peer{transport.Peer(server.Address), r.transport.Peer(r.nodes[0].Address)} {
+		keys, err := peer.ListKeys(ctx, nil, nil, false)
+		if err != nil || len(keys) != all {
+			t.Fatalf("ListKeys = %d keys, %v; want %d", len(keys), err, all)
+		}
+		files, err := peer.ListKeys(ctx, nil, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]KeyInfo)
+		for _, k := range files {
+			got[k.Key] = k
+		}
+		if len(got) != 2 || got["kept.bin"].Size != int64(len(data)) || got["kept.bin"].Deleted ||
+			!got["listed.bin"].Deleted || got["listed.bin"].Size != -1 {
+			t.Errorf("ListKeys of the files = %+v, want kept.bin of %d bytes and deleted listed.bin", files, len(data))
+		}
+	}
+}
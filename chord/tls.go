@@ -0,0 +1,129 @@
+package chord
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// TLSFiles says where a node finds its certificates
+type TLSFiles struct {
+	CA   string // CA that signs every node certificate
+	Cert string // this node's certificate
+	Key  string // and its private key
+
+	// Mutual makes the node present its certificate when calling others and
+	// require one from everybody calling it
+	Mutual bool
+}
+
+// DefaultTLSFiles is the shared server certificate from certs/generate_certs.sh
+var DefaultTLSFiles = TLSFiles{
+	CA:   "certs/ca-cert.pem",
+	Cert: "certs/server-cert.pem",
+	Key:  "certs/server-key.pem",
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// serverCredentials are used by our gRPC server
+func (f TLSFiles) serverCredentials() (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if f.Mutual {
+		pool, err := loadCertPool(f.CA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// clientCredentials are used when calling other nodes
+func (f TLSFiles) clientCredentials() (credentials.TransportCredentials, error) {
+	pool, err := loadCertPool(f.CA)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{RootCAs: pool}
+	if f.Mutual {
+		cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// identifier returns the node id bound to our certificate
+func (f TLSFiles) identifier() (*big.Int, error) {
+	data, err := os.ReadFile(f.Cert)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", f.Cert)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return certIdentifier(cert), nil
+}
+
+// certIdentifier is the ring position a certificate entitles its holder to:
+// the SHA-1 of its public key. Nobody can choose where their node lands
+// without a CA signature on a key that happens to hash there.
+func certIdentifier(cert *x509.Certificate) *big.Int {
+	sum := sha1.Sum(cert.RawSubjectPublicKeyInfo)
+	return new(big.Int).SetBytes(sum[:])
+}
+
+// checkCaller makes sure the node calling us holds the certificate for the
+// identifier it claims. It only applies when the node requires client
+// certificates; otherwise every caller is taken at its word.
+func (n *Node) checkCaller(ctx context.Context, claimed NodeRef) error {
+	if !n.verifyCallers {
+		return nil
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no peer information")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return status.Error(codes.Unauthenticated, "no client certificate")
+	}
+	id := certIdentifier(info.State.PeerCertificates[0])
+	if claimed.Identifier == nil || id.Cmp(claimed.Identifier) != 0 {
+		return status.Errorf(codes.PermissionDenied, "%s claims identifier %040x, but its certificate is for %040x", claimed.Address, claimed.Identifier, id)
+	}
+	return nil
+}
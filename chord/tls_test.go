@@ -0,0 +1,171 @@
+package chord
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "chord/protocol"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testCA issues node certificates into a temporary directory
+type testCA struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ChordCA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{t: t, dir: t.TempDir(), cert: cert, key: key}
+	ca.write("ca-cert.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(name, typ string, der []byte) string {
+	p := filepath.Join(ca.dir, name)
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		ca.t.Fatal(err)
+	}
+	return p
+}
+
+// issue creates a certificate for a node on localhost
+func (ca *testCA) issue(name string) TLSFiles {
+	ca.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	return TLSFiles{
+		CA:     filepath.Join(ca.dir, "ca-cert.pem"),
+		Cert:   ca.write(name+"-cert.pem", "CERTIFICATE", der),
+		Key:    ca.write(name+"-key.pem", "PRIVATE KEY", keyDER),
+		Mutual: true,
+	}
+}
+
+// serveTLS starts a node behind a real TLS listener and returns it
+func serveTLS(t *testing.T, files TLSFiles) *Node {
+	t.Helper()
+	id, err := files.identifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := files.serverCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := newNode(lis.Addr().String(), id, testSuccessorList, newMemStore(), nil)
+	n.verifyCallers = files.Mutual
+	n.create()
+	n.server = grpc.NewServer(grpc.Creds(creds))
+	pb.RegisterChordServer(n.server, n)
+	go n.server.Serve(lis)
+	t.Cleanup(n.server.Stop)
+	return n
+}
+
+func TestMutualTLSBindsIdentifierToCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	server := serveTLS(t, ca.issue("server"))
+
+	clientFiles := ca.issue("client")
+	clientID, err := clientFiles.identifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, err := newGRPCTransport(clientFiles, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	ctx := context.Background()
+	peer := transport.Peer(server.Address)
+
+	// claiming somebody else's place in the ring is refused
+	forged := NodeRef{Address: "127.0.0.1:1", Identifier: new(big.Int).Sub(server.id(), big.NewInt(1))}
+	if err := peer.Notify(ctx, forged); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Notify with a forged identifier: got %v, want PermissionDenied", err)
+	}
+	if !server.Predecessor.IsZero() {
+		t.Fatalf("forged Notify changed the predecessor to %s", server.Predecessor.Address)
+	}
+	if err := peer.Leave(ctx, Neighbours{Self: forged}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Leave with a forged identifier: got %v, want PermissionDenied", err)
+	}
+
+	// our own identifier is accepted
+	self := NodeRef{Address: "127.0.0.1:2", Identifier: clientID}
+	if err := peer.Notify(ctx, self); err != nil {
+		t.Fatalf("Notify with the certificate's identifier: %v", err)
+	}
+	if server.Predecessor.Address != self.Address {
+		t.Fatalf("predecessor is %q, want %s", server.Predecessor.Address, self.Address)
+	}
+
+	// and a caller without a certificate does not get in at all
+	anonymous := clientFiles
+	anonymous.Mutual = false
+	plain, err := newGRPCTransport(anonymous, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if err := plain.Peer(server.Address).Ping(ctx); err == nil {
+		t.Fatal("Ping without a client certificate succeeded")
+	}
+}
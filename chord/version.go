@@ -0,0 +1,115 @@
+package chord
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "chord/protocol"
+)
+
+// errConflict is wrapped into the error of a write that lost against a
+// concurrent write to the same key
+var errConflict = errors.New("conflicting write")
+
+// IsConflict reports whether err means a write lost against another write
+// to the same file, or was conditional on a version it no longer is at
+func IsConflict(err error) bool {
+	return errors.Is(err, errConflict)
+}
+
+// errNotFound is wrapped into the error of a delete of a file that does
+// not exist
+var errNotFound = errors.New("file not found")
+
+// IsNotFound reports whether err means the file did not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, errNotFound)
+}
+
+// Version orders the writes to a key. Clock is a Lamport clock: a node
+// writing a key picks a clock past every version it has seen, so a write
+// made after reading a version always comes after it. Writer, the id of
+// the node that made the write, breaks ties so that every replica picks
+// the same winner between concurrent writes.
+type Version struct {
+	Clock  uint64
+	Writer string
+}
+
+// IsZero reports whether v is the version of a key nobody wrote yet
+func (v Version) IsZero() bool {
+	return v.Clock == 0 && v.Writer == ""
+}
+
+// Less reports whether v was written before o
+func (v Version) Less(o Version) bool {
+	if v.Clock != o.Clock {
+		return v.Clock < o.Clock
+	}
+	return v.Writer < o.Writer
+}
+
+// String formats v as clock@writer, which ParseVersion reads back
+func (v Version) String() string {
+	return fmt.Sprintf("%d@%s", v.Clock, v.Writer)
+}
+
+// ParseVersion reads a version as String formats it
+func ParseVersion(s string) (Version, error) {
+	clock, writer, found := strings.Cut(s, "@")
+	if !found {
+		return Version{}, fmt.Errorf("invalid version %q: want <clock>@<writer>", s)
+	}
+	c, err := strconv.ParseUint(clock, 10, 64)
+	if err != nil {
+		return Version{}, fmt.Errorf("invalid version %q: %v", s, err)
+	}
+	return Version{Clock: c, Writer: writer}, nil
+}
+
+func (v Version) toProto() *pb.Version {
+	return &pb.Version{Clock: v.Clock, Writer: v.Writer}
+}
+
+// expectedToProto encodes the condition of a write, nil for none
+func expectedToProto(expected *Version) *pb.Version {
+	if expected == nil {
+		return nil
+	}
+	return expected.toProto()
+}
+
+func versionFromProto(v *pb.Version) Version {
+	if v == nil {
+		return Version{}
+	}
+	return Version{Clock: v.Clock, Writer: v.Writer}
+}
+
+func expectedFromProto(v *pb.Version) *Version {
+	if v == nil {
+		return nil
+	}
+	expected := versionFromProto(v)
+	return &expected
+}
+
+// observe moves our Lamport clock past v
+func (n *Node) observe(v Version) {
+	n.clockMu.Lock()
+	defer n.clockMu.Unlock()
+	if v.Clock > n.clock {
+		n.clock = v.Clock
+	}
+}
+
+// nextVersion returns the version for a write we make to a key whose
+// current version is base
+func (n *Node) nextVersion(base Version) Version {
+	n.clockMu.Lock()
+	defer n.clockMu.Unlock()
+	n.clock = max(n.clock, base.Clock) + 1
+	return Version{Clock: n.clock, Writer: fmt.Sprintf("%040x", n.id())}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"chord/chord"
+)
+
+// exit codes of the commands, for scripts
+const (
+	exitOK       = 0
+	exitError    = 1 // the command failed, e.g. the ring could not be reached
+	exitUsage    = 2
+	exitNotFound = 3
+	exitConflict = 4
+)
+
+// command is run as chord <name> [flags] <args>, against the ring the
+// --node flags point at
+type command struct {
+	args string // what it takes besides flags
+	help string
+	// nargs is how many args it takes; flags adds its own flags
+	nargs int
+	flags func(fs *flag.FlagSet, o *options)
+	run   func(ctx context.Context, c *chord.Client, o *options, args []string) (result, error)
+}
+
+// result is what a command prints: as JSON with --json, as text otherwise
+type result interface {
+	printText(w io.Writer)
+}
+
+var commands = map[string]command{
+	"put": {
+		args:  "<local file>",
+		help:  "Store a file, - for stdin with --name",
+		nargs: 1,
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.name, "name", "", "store the file under this name instead of its base name")
+			fs.BoolVar(&o.dedup, "dedup", false, "store the file by its content")
+		},
+		run: runPut,
+	},
+	"get": {
+		args:  "<filename>",
+		help:  "Read a file, to stdout or to -o",
+		nargs: 1,
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.output, "o", "", "write the file here, which must not exist yet, instead of to stdout")
+		},
+		run: runGet,
+	},
+	"delete": {
+		args:  "<filename>",
+		help:  "Delete a file",
+		nargs: 1,
+		run:   runDelete,
+	},
+	"ls": {
+		help: "List the files in the ring",
+		run:  runList,
+	},
+	"ring": {
+		help: "List the nodes of the ring, in order",
+		run:  runRing,
+	},
+}
+
+// options are the flags of a command
+type options struct {
+	nodes    stringList
+	json     bool
+	verbose  bool
+	password string
+	timeout  int
+	tls      chord.TLSFiles
+	nameKey  string
+	identity string
+
+	replicas, readQuorum, writeQuorum int
+
+	name   string
+	dedup  bool
+	output string
+
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// runCommand runs a command on the given standard streams and returns the
+// exit code
+func runCommand(name string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cmd := commands[name]
+	o := &options{tls: chord.DefaultTLSFiles, stdin: stdin, stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet("chord "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Var(&o.nodes, "node", "address of a node of the ring; can be repeated")
+	fs.BoolVar(&o.json, "json", false, "print the result as JSON")
+	fs.BoolVar(&o.verbose, "v", false, "log what happens on the way")
+	fs.StringVar(&o.password, "password", os.Getenv("CHORD_PASSWORD"), "password of the file, $CHORD_PASSWORD by default")
+	fs.IntVar(&o.timeout, "timeout", 0, "how long, in milliseconds, to wait for a node to answer")
+	fs.StringVar(&o.tls.CA, "ca", o.tls.CA, "CA certificate")
+	fs.StringVar(&o.tls.Cert, "cert", o.tls.Cert, "our certificate")
+	fs.StringVar(&o.tls.Key, "key", o.tls.Key, "and its private key")
+	fs.BoolVar(&o.tls.Mutual, "mtls", false, "present our certificate to the nodes")
+	fs.StringVar(&o.nameKey, "name-key", "", "file with the secret that file names are hashed with")
+	fs.StringVar(&o.identity, "identity", "", "file with our X25519 key, for files shared with us")
+	fs.IntVar(&o.replicas, "replicas", 0, "number of nodes every file is written to")
+	fs.IntVar(&o.readQuorum, "read-quorum", 0, "replicas that have to answer a read")
+	fs.IntVar(&o.writeQuorum, "write-quorum", 0, "replicas that have to acknowledge a write")
+	if cmd.flags != nil {
+		cmd.flags(fs, o)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: chord %s [flags] %s\n%s\n\nFlags:\n", name, cmd.args, cmd.help)
+		fs.PrintDefaults()
+	}
+
+	// flags may come after the arguments, too
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(rest) != cmd.nargs {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(o.nodes) == 0 {
+		fmt.Fprintf(stderr, "chord %s: no --node to reach the ring through\n", name)
+		return exitUsage
+	}
+	if !o.verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	client, err := newClient(o)
+	if err != nil {
+		return fail(o, name, exitUsage, err)
+	}
+	defer client.Close()
+
+	res, err := cmd.run(context.Background(), client, o, rest)
+	if err != nil {
+		code := exitError
+		switch {
+		case errors.Is(err, errNotFound) || chord.IsNotFound(err):
+			code = exitNotFound
+		case chord.IsConflict(err):
+			code = exitConflict
+		case errors.Is(err, errUsage):
+			code = exitUsage
+		}
+		return fail(o, name, code, err)
+	}
+	if res == nil {
+		return exitOK
+	}
+	if o.json {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(res)
+	} else {
+		res.printText(stdout)
+	}
+	return exitOK
+}
+
+var (
+	errNotFound = errors.New("file not found")
+	errUsage    = errors.New("invalid usage")
+)
+
+// fail reports err, as JSON on stdout with --json, and returns code
+func fail(o *options, name string, code int, err error) int {
+	if o.json {
+		json.NewEncoder(o.stdout).Encode(map[string]any{"error": err.Error(), "code": code})
+	} else {
+		fmt.Fprintf(o.stderr, "chord %s: %v\n", name, err)
+	}
+	return code
+}
+
+// newClient connects to the ring as the options say
+func newClient(o *options) (*chord.Client, error) {
+	cfg := chord.ClientConfig{
+		TLS:         o.tls,
+		Timeout:     time.Duration(o.timeout) * time.Millisecond,
+		Replicas:    o.replicas,
+		ReadQuorum:  o.readQuorum,
+		WriteQuorum: o.writeQuorum,
+		Dedup:       o.dedup,
+	}
+	for _, node := range o.nodes {
+		cfg.Seeds = append(cfg.Seeds, resolveAddress(node))
+	}
+	if o.nameKey != "" {
+		data, err := os.ReadFile(o.nameKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --name-key: %v", err)
+		}
+		if cfg.NameKey = bytes.TrimSpace(data); len(cfg.NameKey) == 0 {
+			return nil, errors.New("--name-key file is empty")
+		}
+	}
+	if o.identity != "" {
+		var err error
+		if cfg.Identity, err = chord.LoadIdentity(o.identity); err != nil {
+			return nil, fmt.Errorf("failed to load --identity: %v", err)
+		}
+	}
+	return chord.NewClient(cfg)
+}
+
+// nodeJSON is a node as the commands print it
+type nodeJSON struct {
+	Address    string `json:"address"`
+	Identifier string `json:"identifier"`
+}
+
+func toNodeJSON(ref chord.NodeRef) nodeJSON {
+	if ref.IsZero() {
+		return nodeJSON{}
+	}
+	return nodeJSON{Address: ref.Address, Identifier: fmt.Sprintf("%040x", ref.Identifier)}
+}
+
+// replicaJSON is how one replica answered
+type replicaJSON struct {
+	nodeJSON
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// writeResult is what put and delete print
+type writeResult struct {
+	Name     string        `json:"name"`
+	Size     *int64        `json:"size,omitempty"`
+	Owner    nodeJSON      `json:"owner"`
+	Replicas []replicaJSON `json:"replicas"`
+
+	verb string
+}
+
+func newWriteResult(verb string, name string, res chord.QuorumResult) *writeResult {
+	w := &writeResult{Name: name, Owner: toNodeJSON(res.Owner), Replicas: []replicaJSON{}, verb: verb}
+	for _, r := range res.Replicas {
+		rj := replicaJSON{nodeJSON: toNodeJSON(r.Node), OK: r.Err == nil}
+		if r.Err != nil {
+			rj.Error = r.Err.Error()
+		}
+		w.Replicas = append(w.Replicas, rj)
+	}
+	return w
+}
+
+func (r *writeResult) printText(w io.Writer) {
+	if r.Size != nil {
+		fmt.Fprintf(w, "%s '%s' (%d bytes), owner %s\n", r.verb, r.Name, *r.Size, r.Owner.Address)
+	} else {
+		fmt.Fprintf(w, "%s '%s', owner %s\n", r.verb, r.Name, r.Owner.Address)
+	}
+	for _, rep := range r.Replicas {
+		if !rep.OK {
+			fmt.Fprintf(w, "  replica %s: failed: %s\n", rep.Address, rep.Error)
+			continue
+		}
+		fmt.Fprintf(w, "  replica %s: ok\n", rep.Address)
+	}
+}
+
+func runPut(ctx context.Context, c *chord.Client, o *options, args []string) (result, error) {
+	if o.password == "" {
+		return nil, fmt.Errorf("%w: no --password or $CHORD_PASSWORD", errUsage)
+	}
+	name := o.name
+	var res chord.QuorumResult
+	var size int64
+	var err error
+	if args[0] == "-" {
+		if name == "" {
+			return nil, fmt.Errorf("%w: --name is needed to store stdin", errUsage)
+		}
+		in := &countingReader{r: o.stdin}
+		res, err = c.Put(ctx, name, in, o.password)
+		size = in.n
+	} else {
+		info, serr := os.Stat(args[0])
+		if serr != nil {
+			return nil, serr
+		}
+		size = info.Size()
+		if name == "" || name == filepath.Base(args[0]) {
+			name = filepath.Base(args[0])
+			res, err = c.PutFile(ctx, args[0], o.password)
+		} else {
+			f, ferr := os.Open(args[0])
+			if ferr != nil {
+				return nil, ferr
+			}
+			defer f.Close()
+			res, err = c.Put(ctx, name, f, o.password)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := newWriteResult("stored", name, res)
+	r.Size = &size
+	return r, nil
+}
+
+func runDelete(ctx context.Context, c *chord.Client, o *options, args []string) (result, error) {
+	res, err := c.Delete(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return newWriteResult("deleted", args[0], res), nil
+}
+
+// getResult is what get prints once the file is written
+type getResult struct {
+	Name    string   `json:"name"`
+	Output  string   `json:"output"`
+	Size    int64    `json:"size"`
+	Version string   `json:"version"`
+	Owner   nodeJSON `json:"owner"`
+}
+
+func (r *getResult) printText(w io.Writer) {
+	fmt.Fprintf(w, "wrote '%s' (%d bytes, version %s) to %s\n", r.Name, r.Size, r.Version, r.Output)
+}
+
+func runGet(ctx context.Context, c *chord.Client, o *options, args []string) (result, error) {
+	if o.output == "" {
+		if o.json {
+			return nil, fmt.Errorf("%w: --json needs -o, as the file goes to stdout otherwise", errUsage)
+		}
+		res, err := c.Get(ctx, args[0], o.password, o.stdout)
+		if err == nil && !res.Found {
+			err = errNotFound
+		}
+		return nil, err
+	}
+
+	// the file appears under its name only once it is complete, and never
+	// in place of one that is there already
+	if _, err := os.Lstat(o.output); err == nil {
+		return nil, fmt.Errorf("%s already exists", o.output)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(o.output), "."+filepath.Base(o.output)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	out := &countingWriter{w: tmp}
+	res, err := c.Get(ctx, args[0], o.password, out)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !res.Found {
+		err = errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// unlike a rename, a link does not replace a file that appeared since
+	if err := os.Link(tmp.Name(), o.output); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%s already exists", o.output)
+		}
+		return nil, err
+	}
+	return &getResult{Name: args[0], Output: o.output, Size: out.n, Version: res.Item.Version.String(), Owner: toNodeJSON(res.Owner)}, nil
+}
+
+// fileJSON is a file as ls prints it
+type fileJSON struct {
+	Name    string   `json:"name"`
+	Size    *int64   `json:"size"` // null if only the password tells
+	Version string   `json:"version"`
+	Owner   nodeJSON `json:"owner"`
+}
+
+type listResult []fileJSON
+
+func (r listResult) printText(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZE\tVERSION\tOWNER")
+	for _, f := range r {
+		size := "?"
+		if f.Size != nil {
+			size = fmt.Sprint(*f.Size)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Name, size, f.Version, f.Owner.Address)
+	}
+	tw.Flush()
+}
+
+func runList(ctx context.Context, c *chord.Client, o *options, args []string) (result, error) {
+	files, err := c.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := listResult{}
+	for _, f := range files {
+		fj := fileJSON{Name: f.Name, Version: f.Version.String(), Owner: toNodeJSON(f.Owner)}
+		if f.Size >= 0 {
+			fj.Size = &f.Size
+		}
+		r = append(r, fj)
+	}
+	return r, nil
+}
+
+type ringResult []nodeJSON
+
+func (r ringResult) printText(w io.Writer) {
+	for _, n := range r {
+		fmt.Fprintf(w, "%s %s\n", n.Identifier, n.Address)
+	}
+}
+
+func runRing(ctx context.Context, c *chord.Client, o *options, args []string) (result, error) {
+	nodes, err := c.Ring(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := ringResult{}
+	for _, n := range nodes {
+		r = append(r, toNodeJSON(n))
+	}
+	return r, nil
+}
+
+// commandHelp lists the commands, for the usage of the binary
+func commandHelp() string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "  chord %-6s %-14s - %s\n", name, commands[name].args, commands[name].help)
+	}
+	return b.String()
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	k, err := c.r.Read(p)
+	c.n += int64(k)
+	return k, err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	k, err := c.w.Write(p)
+	c.n += int64(k)
+	return k, err
+}
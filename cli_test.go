@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"chord/chord"
+)
+
+// writePEM writes a PEM block into dir and returns its path
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// testNode starts a ring of one node behind TLS, and returns the node and
+// the flags that point the commands at it
+func testNode(t *testing.T) (*chord.Node, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ChordCA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := chord.TLSFiles{
+		CA:   writePEM(t, dir, "ca-cert.pem", "CERTIFICATE", caDER),
+		Cert: writePEM(t, dir, "node-cert.pem", "CERTIFICATE", der),
+		Key:  writePEM(t, dir, "node-key.pem", "PRIVATE KEY", keyDER),
+	}
+
+	n, err := chord.New(chord.Config{Address: "127.0.0.1:0", TLS: files, UploadDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Stop(context.Background()) })
+
+	// the client keeps the journals of its uploads in the temp dir
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("CHORD_PASSWORD", "")
+	return n, []string{"--node", n.Address, "--ca", files.CA, "--replicas", "1", "--read-quorum", "1", "--write-quorum", "1"}
+}
+
+// run runs the command in args and returns its exit code and what it
+// printed to stdout and stderr
+func run(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := runCommand(args[0], args[1:], strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	n, node := testNode(t)
+	dir := t.TempDir()
+	local := filepath.Join(dir, "report.csv")
+	if err := os.WriteFile(local, []byte("a,b\n1,2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(dir, "existing.csv")
+	if err := os.WriteFile(existing, []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the steps run in order, on what the ones before stored
+	steps := []struct {
+		name  string
+		stdin string
+		args  []string
+		code  int
+		out   string // what stdout has to contain
+	}{
+		{"put", "", []string{"put", local, "--password", "pw"}, exitOK, "stored 'report.csv' (8 bytes)"},
+		{"put under another name", "", []string{"put", "--name", "copy.csv", "--password", "pw", local}, exitOK, "stored 'copy.csv' (8 bytes)"},
+		{"put stdin", "from stdin", []string{"put", "-", "--name", "piped.txt", "--password", "pw"}, exitOK, "stored 'piped.txt' (10 bytes)"},
+		{"put stdin without a name", "x", []string{"put", "-", "--password", "pw"}, exitUsage, ""},
+		{"put without a password", "", []string{"put", local}, exitUsage, ""},
+		{"put a missing file", "", []string{"put", filepath.Join(dir, "missing"), "--password", "pw"}, exitError, ""},
+		{"no argument", "", []string{"get", "--password", "pw"}, exitUsage, ""},
+		{"too many arguments", "", []string{"get", "report.csv", "copy.csv", "--password", "pw"}, exitUsage, ""},
+		{"unknown flag", "", []string{"ls", "--bogus"}, exitUsage, ""},
+		{"help", "", []string{"ls", "-h"}, exitOK, ""},
+		{"get to stdout", "", []string{"get", "report.csv", "--password", "pw"}, exitOK, "a,b\n1,2\n"},
+		{"flags before the argument", "", []string{"get", "--password", "pw", "piped.txt"}, exitOK, "from stdin"},
+		{"get with the wrong password", "", []string{"get", "report.csv", "--password", "wrong"}, exitError, ""},
+		{"get a missing file", "", []string{"get", "never.txt", "--password", "pw"}, exitNotFound, ""},
+		{"--json without -o", "", []string{"get", "report.csv", "--password", "pw", "--json"}, exitUsage, ""},
+		{"get -o", "", []string{"get", "report.csv", "-o", filepath.Join(dir, "out.csv"), "--password", "pw"}, exitOK, "wrote 'report.csv' (8 bytes"},
+		{"get -o onto a file", "", []string{"get", "report.csv", "-o", existing, "--password", "pw"}, exitError, ""},
+		{"get -o of a missing file", "", []string{"get", "never.txt", "-o", filepath.Join(dir, "never.txt"), "--password", "pw"}, exitNotFound, ""},
+		{"ls", "", []string{"ls"}, exitOK, "piped.txt"},
+		{"ring", "", []string{"ring"}, exitOK, n.Address},
+		{"delete", "", []string{"delete", "piped.txt"}, exitOK, "deleted 'piped.txt'"},
+		{"delete again", "", []string{"delete", "piped.txt"}, exitNotFound, ""},
+		{"delete a file that never existed", "", []string{"delete", "never.txt"}, exitNotFound, ""},
+		{"get a deleted file", "", []string{"get", "piped.txt", "--password", "pw"}, exitNotFound, ""},
+	}
+	for _, step := range steps {
+		code, out, errOut := run(step.stdin, append(step.args, node...)...)
+		if code != step.code {
+			t.Fatalf("%s: exit code %d, want %d; stderr: %s", step.name, code, step.code, errOut)
+		}
+		if !strings.Contains(out, step.out) {
+			t.Errorf("%s: printed %q, want it to contain %q", step.name, out, step.out)
+		}
+	}
+
+	if got, err := os.ReadFile(filepath.Join(dir, "out.csv")); err != nil || string(got) != "a,b\n1,2\n" {
+		t.Errorf("get -o wrote %q, %v", got, err)
+	}
+	if got, err := os.ReadFile(existing); err != nil || string(got) != "keep me" {
+		t.Errorf("get -o replaced a file that was there: %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "never.txt")); err == nil {
+		t.Error("get -o of a missing file created the output")
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*")); len(leftovers) != 0 {
+		t.Errorf("get -o left temporary files behind: %v", leftovers)
+	}
+	if _, ok, _ := n.Bucket.Get("never.txt"); ok {
+		t.Error("deleting a file that never existed wrote a tombstone")
+	}
+}
+
+func TestCommandsNeedANode(t *testing.T) {
+	if code, _, errOut := run("", "ls"); code != exitUsage || !strings.Contains(errOut, "no --node") {
+		t.Errorf("ls without --node: exit code %d, %q", code, errOut)
+	}
+}
+
+func TestCommandsPrintJSON(t *testing.T) {
+	n, node := testNode(t)
+	dir := t.TempDir()
+	local := filepath.Join(dir, "data.bin")
+	if err := os.WriteFile(local, []byte("twelve bytes"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	runJSON := func(want int, v any, args ...string) {
+		t.Helper()
+		code, out, errOut := run("", append(append(args, "--json"), node...)...)
+		if code != want {
+			t.Fatalf("%s: exit code %d, want %d; stderr: %s", args[0], code, want, errOut)
+		}
+		if err := json.Unmarshal([]byte(out), v); err != nil {
+			t.Fatalf("%s printed %q: %v", args[0], out, err)
+		}
+	}
+
+	var put struct {
+		Name     string
+		Size     *int64
+		Owner    struct{ Address, Identifier string }
+		Replicas []struct {
+			Address string
+			OK      bool
+		}
+	}
+	runJSON(exitOK, &put, "put", local, "--password", "pw")
+	if put.Name != "data.bin" || put.Size == nil || *put.Size != 12 || put.Owner.Address != n.Address || len(put.Owner.Identifier) != 40 {
+		t.Errorf("put printed %+v", put)
+	}
+	if len(put.Replicas) != 1 || !put.Replicas[0].OK || put.Replicas[0].Address != n.Address {
+		t.Errorf("put printed replicas %+v", put.Replicas)
+	}
+
+	var get struct {
+		Name, Output, Version string
+		Size                  int64
+	}
+	out := filepath.Join(dir, "out.bin")
+	runJSON(exitOK, &get, "get", "data.bin", "-o", out, "--password", "pw")
+	if get.Name != "data.bin" || get.Output != out || get.Size != 12 || get.Version == "" {
+		t.Errorf("get printed %+v", get)
+	}
+
+	var files []struct {
+		Name, Version string
+		Size          *int64
+	}
+	runJSON(exitOK, &files, "ls")
+	if len(files) != 1 || files[0].Name != "data.bin" || files[0].Size == nil || *files[0].Size != 12 || files[0].Version != get.Version {
+		t.Errorf("ls printed %+v", files)
+	}
+
+	var ring []struct{ Address, Identifier string }
+	runJSON(exitOK, &ring, "ring")
+	if len(ring) != 1 || ring[0].Address != n.Address || ring[0].Identifier != put.Owner.Identifier {
+		t.Errorf("ring printed %+v", ring)
+	}
+
+	var del struct {
+		Name string
+		Size *int64
+	}
+	runJSON(exitOK, &del, "delete", "data.bin")
+	if del.Name != "data.bin" || del.Size != nil {
+		t.Errorf("delete printed %+v", del)
+	}
+
+	// errors are JSON too, with the exit code in them
+	var fail struct {
+		Error string
+		Code  int
+	}
+	runJSON(exitNotFound, &fail, "delete", "data.bin")
+	if fail.Code != exitNotFound || fail.Error == "" {
+		t.Errorf("a failed delete printed %+v", fail)
+	}
+	runJSON(exitNotFound, &fail, "get", "data.bin", "-o", filepath.Join(dir, "gone.bin"), "--password", "pw")
+	if fail.Code != exitNotFound || fail.Error == "" {
+		t.Errorf("a failed get printed %+v", fail)
+	}
+}
@@ -2,29 +2,35 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"math/big"
 	"net"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
-	pb "chord/protocol" // Update path as needed
-
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
+	"chord/chord"
 )
 
 var localaddress string
 
-// Find our local IP address
 func init() {
 	// Configure log package to show short filename, line number and timestamp with only time
 	log.SetFlags(log.Lshortfile | log.Ltime)
+}
 
+// findLocalAddress finds our local IP address
+func findLocalAddress() {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
 		log.Fatal(err)
@@ -43,115 +49,62 @@ func init() {
 // resolveAddress handles :port format by adding the local address
 func resolveAddress(address string) string {
 	if strings.HasPrefix(address, ":") {
+		if localaddress == "" {
+			findLocalAddress()
+		}
 		return net.JoinHostPort(localaddress, address[1:])
 	} else if !strings.Contains(address, ":") {
-		return net.JoinHostPort(address, defaultPort)
+		return net.JoinHostPort(address, "3410")
 	}
 	return address
 }
 
-//at the moment -i only matters when joining, not implemented for the lookups etc.
-
-// StartServer starts the gRPC server for this node
-func StartServer(address string, nprime string, ts int, tff int, tcp int, r int, id string) (*Node, error) {
-	address = resolveAddress(address)
-
-	node := &Node{
-		Address:           address,
-		FingerTable:       make([]string, keySize+1),
-		Predecessor:       "",
-		Successors:        nil,
-		Bucket:            make(map[string][]byte),
-		SuccessorListSize: r,
-		Identifier:        nil,
-	}
-	var iden *big.Int
-	if id != "" {
-		iden = new(big.Int)
-		iden.SetString(id, 16) // Assumes identifier is hexadecimal
-		// Or use base 10 if it's decimal:
-		// id.SetString(identifier, 10)
+// printReplicas shows which replicas took part in a read or write
+func printReplicas(res chord.QuorumResult) {
+	for _, r := range res.Replicas {
+		if r.Err != nil {
+			fmt.Printf("  replica %s: failed: %v\n", r.Node, r.Err)
+			continue
+		}
+		fmt.Printf("  replica %s: ok\n", r.Node)
 	}
-	node.Identifier = iden
+}
 
-	// Are we the first node?
-	if nprime == "" {
-		log.Print("StartServer: creating new ring")
-		node.create()
-	} else {
-		log.Print("StartServer: joining existing ring using ", nprime)
-		// For now use the given address as our successor
-		nprime = resolveAddress(nprime)
-		//node.Successors = []string{}
-		// TODO: use a GetAll request to populate our bucket
-		node.join(nprime)
+// saveFile writes the file key to out, which must not exist yet. The file
+// only appears under out once it is complete and matches its checksum.
+func saveFile(node *chord.Node, key, password, out string) (int64, []byte, error) {
+	if _, err := os.Lstat(out); err == nil {
+		return 0, nil, fmt.Errorf("%s already exists", out)
 	}
-
-	// Load TLS credentials
-	creds, err := credentials.NewServerTLSFromFile(
-		"certs/server-cert.pem",
-		"certs/server-key.pem",
-	)
+	tmp, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*")
 	if err != nil {
-		return nil, fmt.Errorf("failed to load TLS credentials: %v", err)
+		return 0, nil, err
+	}
+	defer os.Remove(tmp.Name())
+	sum := sha256.New()
+	w := &countingWriter{w: io.MultiWriter(tmp, sum)}
+	res, err := node.FetchFile(context.Background(), key, password, w)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !res.Found {
+		err = errNotFound
 	}
-
-	// Start listening for RPC calls
-	grpcServer := grpc.NewServer(grpc.Creds(creds))
-	pb.RegisterChordServer(grpcServer, node)
-
-	lis, err := net.Listen("tcp", node.Address)
 	if err != nil {
-		return nil, fmt.Errorf("failed to listen: %v", err)
+		return 0, nil, err
 	}
-
-	// Start server in goroutine
-	log.Printf("Starting Chord node server on %s", node.Address)
-	go func() {
-		if err := grpcServer.Serve(lis); err != nil {
-			log.Fatalf("failed to serve: %v", err)
-		}
-	}()
-
-	// Start background tasks
-	go func() {
-		wait := time.Second / 3
-		if ts == 0 {
-			wait = time.Duration(ts) * time.Millisecond
-		}
-		for {
-			time.Sleep(wait)
-			node.stabilize()
-		}
-	}()
-	go func() {
-		time.Sleep(time.Second * 2)
-		wait := time.Second / 3
-		if ts == 0 {
-			wait = time.Duration(tff) * time.Millisecond
-		}
-		nextFinger := 0
-		for {
-			time.Sleep(wait)
-			nextFinger = node.fixFingers(nextFinger)
-		}
-	}()
-	go func() {
-		wait := time.Second / 3
-		if ts == 0 {
-			wait = time.Duration(tcp) * time.Millisecond
+	// unlike a rename, a link does not replace a file that appeared since
+	if err := os.Link(tmp.Name(), out); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return 0, nil, fmt.Errorf("%s already exists", out)
 		}
-		for {
-			time.Sleep(wait)
-			node.checkPredecessor()
-		}
-	}()
-
-	return node, nil
+		return 0, nil, err
+	}
+	return w.n, sum.Sum(nil), nil
 }
 
 // RunShell provides an interactive command shell
-func RunShell(node *Node) {
+func RunShell(node *chord.Node) {
 	reader := bufio.NewReader(os.Stdin)
 
 	for {
@@ -178,50 +131,176 @@ func RunShell(node *Node) {
 			fmt.Println("  ping <address>    - Ping another node")
 			fmt.Println("                      (You can use :port for localhost)")
 			fmt.Println("  Lookup <filename> <password>              - Lookup the node responsible for a key")
-			fmt.Println("  StoreFile <local path/filename> <password> - Store a file in the DHT")
+			fmt.Println("  Lookup <content reference>                - Lookup a file stored by content")
+			fmt.Println("  Lookup <filename>                         - Lookup a file shared with us")
+			fmt.Println("  Get <filename> <password> [outfile]       - Save a file, to its name by default")
+			fmt.Println("                      (- as the password for a file shared with us)")
+			fmt.Println("  Get <content reference> <outfile>          - Save a file stored by content")
+			fmt.Println("  StoreFile <local path/filename> <password> [version] - Store a file in the DHT")
+			fmt.Println("  Delete <filename> [version]                - Delete a file from the DHT")
+			fmt.Println("                      (with a version, only if the file is still at it)")
+			fmt.Println("  share <filename> <password> <public key>   - Let the holder of a key read a file")
+			fmt.Println("  revoke <filename> <password> <public key>  - Stop sharing a file with them")
+			fmt.Println("  pubkey            - Show our public key, for others to share files with us")
 			fmt.Println("  dump              - Display info about the current node")
+			fmt.Println("  leave             - Hand over our files and leave the ring")
 			fmt.Println("  quit              - Exit the program")
 		case "Lookup":
+			if len(parts) == 2 {
+				// the reference holds the key to the file, and a file shared
+				// with us opens with our identity
+				if chord.IsContentRef(parts[1]) || node.Identity != nil {
+					parts = append(parts, "")
+				}
+			}
 			if len(parts) < 3 {
 				fmt.Println("Usage: Lookup <key> <password>")
 				continue
 			}
-			_, _, f, err2 := node.Lookup(parts[1])
-			if err2 != nil {
-				fmt.Printf("Lookup failed: %v\n", err2)
+			stat, res, err := node.StatFile(context.Background(), parts[1], parts[2])
+			if err != nil {
+				fmt.Printf("Lookup failed: %v\n", err)
+				printReplicas(res.QuorumResult)
 				continue
 			}
-			if f == nil {
+			if !res.Found {
 				fmt.Printf("file not found\n")
+				printReplicas(res.QuorumResult)
 				continue
 			}
-			nodeid, adress, file, err := node.LookupFile(parts[1], parts[2])
-			if err != nil {
-				fmt.Printf("Lookup failed: %v\n", err)
-			} else {
-				if file != nil {
-					fmt.Printf("Key '%s' (ID: %s) is located at node %s (ID: %s)\n", parts[1], nodeid.String(), adress, nodeid.String())
-					fmt.Printf("Associated file: %s\n", file)
-				} else {
-					fmt.Printf("file not found")
+			fmt.Printf("Key '%s' (ID: %040x) is located at node %s (ID: %040x)\n", parts[1], node.FileID(parts[1]), res.Owner.Address, res.Owner.Identifier)
+			printReplicas(res.QuorumResult)
+			fmt.Printf("Version: %s\n", res.Item.Version)
+			fmt.Printf("Size: %d bytes\n", stat.Size)
+			fmt.Printf("SHA-256: %x\n", stat.Checksum)
+			if ref, ok := node.ContentRef(res.Item.Value, parts[1], parts[2]); ok {
+				fmt.Printf("Content: %s\n", ref)
+			}
+		case "Get":
+			var key, password, out string
+			switch {
+			case len(parts) > 1 && chord.IsContentRef(parts[1]):
+				// the reference holds the key to the file
+				key = parts[1]
+				if len(parts) > 2 {
+					out = parts[2]
+				}
+			case len(parts) == 2 && node.Identity != nil:
+				key = parts[1]
+			case len(parts) > 2:
+				key, password = parts[1], parts[2]
+				if password == "-" {
+					password = ""
 				}
+				if len(parts) > 3 {
+					out = parts[3]
+				}
+			default:
+				fmt.Println("Usage: Get <key> <password> [outfile]")
+				continue
 			}
+			if out == "" {
+				if chord.IsContentRef(key) {
+					fmt.Println("Usage: Get <content reference> <outfile>")
+					continue
+				}
+				out = filepath.Base(key)
+			}
+			size, sum, err := saveFile(node, key, password, out)
+			if err != nil {
+				fmt.Printf("Get failed: %v\n", err)
+				continue
+			}
+			fmt.Printf("Saved '%s' to %s: %d bytes, SHA-256 %x\n", key, out, size, sum)
 		case "StoreFile":
 			if len(parts) < 3 {
-				fmt.Println("Usage: StoreFile <local path/filename> <password>")
+				fmt.Println("Usage: StoreFile <local path/filename> <password> [version]")
 				continue
 			}
-			err := node.StoreFile(parts[1], parts[2])
+			var res chord.QuorumResult
+			if len(parts) > 3 {
+				expected, perr := chord.ParseVersion(parts[3])
+				if perr != nil {
+					fmt.Println(perr)
+					continue
+				}
+				res, err = node.StoreFileIf(context.Background(), parts[1], parts[2], expected)
+			} else {
+				res, err = node.StoreFile(context.Background(), parts[1], parts[2])
+			}
 			if err != nil {
 				fmt.Printf("StoreFile failed: %v\n", err)
 			} else {
 				fmt.Printf("File '%s' stored successfully in the DHT\n", parts[1])
 			}
+			printReplicas(res)
+
+		case "Delete":
+			if len(parts) < 2 {
+				fmt.Println("Usage: Delete <filename> [version]")
+				continue
+			}
+			var res chord.QuorumResult
+			if len(parts) > 2 {
+				expected, perr := chord.ParseVersion(parts[2])
+				if perr != nil {
+					fmt.Println(perr)
+					continue
+				}
+				res, err = node.DeleteFileIf(context.Background(), parts[1], expected)
+			} else {
+				res, err = node.DeleteFile(context.Background(), parts[1])
+			}
+			if err != nil {
+				fmt.Printf("Delete failed: %v\n", err)
+			} else {
+				fmt.Printf("File '%s' deleted from the DHT\n", parts[1])
+			}
+			printReplicas(res)
+
+		case "share", "revoke":
+			if len(parts) < 4 {
+				fmt.Printf("Usage: %s <filename> <password> <public key>\n", parts[0])
+				continue
+			}
+			pub, perr := chord.ParsePublicKey(parts[3])
+			if perr != nil {
+				fmt.Println(perr)
+				continue
+			}
+			var res chord.QuorumResult
+			if parts[0] == "share" {
+				res, err = node.ShareFile(context.Background(), parts[1], parts[2], pub)
+			} else {
+				res, err = node.RevokeFile(context.Background(), parts[1], parts[2], pub)
+			}
+			if err != nil {
+				fmt.Printf("%s failed: %v\n", parts[0], err)
+			} else if parts[0] == "share" {
+				fmt.Printf("File '%s' shared with %s\n", parts[1], parts[3])
+			} else {
+				fmt.Printf("File '%s' no longer shared with %s\n", parts[1], parts[3])
+			}
+			printReplicas(res)
+
+		case "pubkey":
+			if node.Identity == nil {
+				fmt.Println("No identity; start the node with --identity <file>")
+				continue
+			}
+			fmt.Println(chord.PublicKeyString(node.Identity.PublicKey()))
 
 		case "dump":
-			node.dump()
+			node.Dump(os.Stdout)
 		case "PrintState":
-			node.dump()
+			node.Dump(os.Stdout)
+		case "leave":
+			if err := node.LeaveRing(context.Background()); err != nil {
+				fmt.Printf("Leave failed: %v\n", err)
+				continue
+			}
+			fmt.Println("Left the ring. Exiting...")
+			return
 		case "quit":
 			fmt.Println("Exiting...")
 			return
@@ -236,20 +315,35 @@ func main() {
 	// -r store in all successor list
 
 	if len(os.Args) < 2 {
-		fmt.Println("Expected at least -a and -p arguments")
+		fmt.Println("Expected at least -a and -p arguments to run a node, or one of")
+		fmt.Print(commandHelp())
 		os.Exit(1)
 	}
+	// chord <command> ... talks to a ring without running a node
+	if _, ok := commands[os.Args[1]]; ok {
+		os.Exit(runCommand(os.Args[1], os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	findLocalAddress()
 
-	var node *Node
 	var address string
 	var port string
 	var ts int
 	var tff int
 	var tcpT int
+	var tae int
 	var ja string
 	var r int
 	var jp int
 	var identifier string
+	var timeout time.Duration
+	timeouts := make(map[string]time.Duration)
+	tlsFiles := chord.DefaultTLSFiles
+	var dataDir string
+	var dedup bool
+	var nameKey []byte
+	var identityFile string
+	var httpAddress string
+	var replicas, readQuorum, writeQuorum int
 	r = 20 //default successor list size
 	for i := 1; i < len(os.Args); i++ {
 		switch os.Args[i] {
@@ -328,6 +422,19 @@ func main() {
 			}
 			tcpT = v
 			i++
+		case "--tae":
+			if i+1 >= len(os.Args) {
+				log.Fatal("missing value for --tae")
+			}
+			v, err := strconv.Atoi(os.Args[i+1])
+			if err != nil {
+				log.Fatalf("invalid integer for --tae: %v", err)
+			}
+			if !(v <= 3600000 && v >= 1) {
+				log.Fatal("--tae must be between 1 and 3600000")
+			}
+			tae = v
+			i++
 		case "-r":
 			if i+1 >= len(os.Args) {
 				log.Fatal("missing value for -r")
@@ -346,11 +453,106 @@ func main() {
 				log.Fatal("missing value for -i")
 			}
 			str := os.Args[i+1]
-			if len(str) == 40 {
+			if len(str) != 40 {
 				log.Fatal("-i identifier must be 40 characters")
 			}
+			if _, ok := new(big.Int).SetString(str, 16); !ok {
+				log.Fatal("-i identifier must match [0-9a-fA-F]")
+			}
 			identifier = str
 			i++
+		case "--timeout":
+			if i+1 >= len(os.Args) {
+				log.Fatal("missing value for --timeout")
+			}
+			// either <ms> for every method or <Method>=<ms> for one of them
+			method, value, found := strings.Cut(os.Args[i+1], "=")
+			if !found {
+				method, value = "", method
+			}
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				log.Fatalf("invalid integer for --timeout: %v", err)
+			}
+			if v < 1 {
+				log.Fatal("--timeout must be at least 1")
+			}
+			if method == "" {
+				timeout = time.Duration(v) * time.Millisecond
+			} else if !slices.Contains(chord.TimeoutMethods(), method) {
+				log.Fatalf("unknown method %q for --timeout, must be one of %s", method, strings.Join(chord.TimeoutMethods(), ", "))
+			} else {
+				timeouts[method] = time.Duration(v) * time.Millisecond
+			}
+			i++
+		case "--ca", "--cert", "--key":
+			if i+1 >= len(os.Args) {
+				log.Fatalf("missing value for %s", os.Args[i])
+			}
+			switch os.Args[i] {
+			case "--ca":
+				tlsFiles.CA = os.Args[i+1]
+			case "--cert":
+				tlsFiles.Cert = os.Args[i+1]
+			case "--key":
+				tlsFiles.Key = os.Args[i+1]
+			}
+			i++
+		case "--data":
+			if i+1 >= len(os.Args) {
+				log.Fatal("missing value for --data")
+			}
+			dataDir = os.Args[i+1]
+			i++
+		case "--replicas", "--read-quorum", "--write-quorum":
+			if i+1 >= len(os.Args) {
+				log.Fatalf("missing value for %s", os.Args[i])
+			}
+			v, err := strconv.Atoi(os.Args[i+1])
+			if err != nil {
+				log.Fatalf("invalid integer for %s: %v", os.Args[i], err)
+			}
+			if v < 1 {
+				log.Fatalf("%s must be at least 1", os.Args[i])
+			}
+			switch os.Args[i] {
+			case "--replicas":
+				replicas = v
+			case "--read-quorum":
+				readQuorum = v
+			case "--write-quorum":
+				writeQuorum = v
+			}
+			i++
+		case "--mtls":
+			tlsFiles.Mutual = true
+		case "--dedup":
+			dedup = true
+		case "--identity":
+			if i+1 >= len(os.Args) {
+				log.Fatal("missing value for --identity")
+			}
+			identityFile = os.Args[i+1]
+			i++
+		case "--http":
+			if i+1 >= len(os.Args) {
+				log.Fatal("missing value for --http")
+			}
+			httpAddress = os.Args[i+1]
+			i++
+		case "--name-key":
+			if i+1 >= len(os.Args) {
+				log.Fatal("missing value for --name-key")
+			}
+			data, err := os.ReadFile(os.Args[i+1])
+			if err != nil {
+				log.Fatalf("failed to read --name-key: %v", err)
+			}
+			nameKey = bytes.TrimSpace(data)
+			if len(nameKey) == 0 {
+				log.Fatal("--name-key file is empty")
+			}
+			i++
 		default:
 			log.Fatalf("unknown argument: %s", os.Args[i])
 		}
@@ -360,26 +562,62 @@ func main() {
 	if address == "" || port == "" {
 		log.Fatal("address and port must be specified with -a and -p")
 	}
-	var err error
-	if ja == "" && jp == 0 {
-		//Create
-		node, err = StartServer(address+":"+port, "", ts, tff, tcpT, r, identifier)
-		if err != nil {
-			log.Fatalf("Failed to create ring: %v", err)
-		}
-		log.Printf("Created new ring with node at %s", node.Address)
-
-	} else if ja != "" {
+	cfg := chord.Config{
+		Address:                  resolveAddress(address + ":" + port),
+		StabilizeInterval:        time.Duration(ts) * time.Millisecond,
+		FixFingersInterval:       time.Duration(tff) * time.Millisecond,
+		CheckPredecessorInterval: time.Duration(tcpT) * time.Millisecond,
+		AntiEntropyInterval:      time.Duration(tae) * time.Millisecond,
+		SuccessorListSize:        r,
+		TLS:                      tlsFiles,
+		Timeout:                  timeout,
+		Timeouts:                 timeouts,
+		Replicas:                 replicas,
+		ReadQuorum:               readQuorum,
+		WriteQuorum:              writeQuorum,
+		HTTPAddress:              httpAddress,
+	}
+	if identifier != "" {
+		cfg.Identifier, _ = new(big.Int).SetString(identifier, 16)
+	}
+	if ja != "" {
 		if jp == 0 {
 			log.Fatal("--jp must be specified when --ja is used")
 		}
-		//Join
-		node, err = StartServer(address+":"+port, ja+":"+strconv.Itoa(jp), ts, tff, tcpT, r, identifier)
+		cfg.Join = []string{resolveAddress(ja + ":" + strconv.Itoa(jp))}
+	}
+	// Keep our items on disk if we were given a place for them
+	if dataDir != "" {
+		store, err := chord.NewFileStore(dataDir)
 		if err != nil {
-			log.Fatalf("Failed to join ring: %v", err)
+			log.Fatalf("failed to open data directory: %v", err)
 		}
-		log.Printf("Joined ring with node at %s", node.Address)
+		cfg.Store = store
+	}
+
+	// How files stored from the shell are stored
+	cfg.Dedup = dedup
+	cfg.NameKey = nameKey
+	if identityFile != "" {
+		identity, err := chord.LoadIdentity(identityFile)
+		if err != nil {
+			log.Fatalf("failed to load --identity: %v", err)
+		}
+		cfg.Identity = identity
+		log.Printf("Public key for sharing: %s", chord.PublicKeyString(identity.PublicKey()))
+	}
 
+	node, err := chord.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up node: %v", err)
+	}
+	if err := node.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start node: %v", err)
+	}
+	if len(cfg.Join) == 0 {
+		log.Printf("Created new ring with node at %s", node.Address)
+	} else {
+		log.Printf("Joined ring with node at %s", node.Address)
 	}
 
 	// Run the interactive shell
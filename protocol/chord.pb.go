@@ -94,17 +94,76 @@ func (*PingResponse) Descriptor() ([]byte, []int) {
 	return file_protocol_chord_proto_rawDescGZIP(), []int{1}
 }
 
-type PutRequest struct {
+// Version orders the writes to a key: a Lamport clock, and the id of the
+// node that made the write to break ties
+type Version struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
-	Value         []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Clock         uint64                 `protobuf:"varint,1,opt,name=clock,proto3" json:"clock,omitempty"`
+	Writer        string                 `protobuf:"bytes,2,opt,name=writer,proto3" json:"writer,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Version) Reset() {
+	*x = Version{}
+	mi := &file_protocol_chord_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Version) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Version) ProtoMessage() {}
+
+func (x *Version) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Version.ProtoReflect.Descriptor instead.
+func (*Version) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Version) GetClock() uint64 {
+	if x != nil {
+		return x.Clock
+	}
+	return 0
+}
+
+func (x *Version) GetWriter() string {
+	if x != nil {
+		return x.Writer
+	}
+	return ""
+}
+
+type PutRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// older versions never replace newer ones or a newer delete
+	Version *Version `protobuf:"bytes,4,opt,name=version,proto3" json:"version,omitempty"`
+	// if set, the put is refused by a node that holds a newer version of the
+	// key than this one
+	Expected      *Version `protobuf:"bytes,5,opt,name=expected,proto3" json:"expected,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PutRequest) Reset() {
 	*x = PutRequest{}
-	mi := &file_protocol_chord_proto_msgTypes[2]
+	mi := &file_protocol_chord_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -116,7 +175,7 @@ func (x *PutRequest) String() string {
 func (*PutRequest) ProtoMessage() {}
 
 func (x *PutRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[2]
+	mi := &file_protocol_chord_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -129,7 +188,7 @@ func (x *PutRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PutRequest.ProtoReflect.Descriptor instead.
 func (*PutRequest) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{2}
+	return file_protocol_chord_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *PutRequest) GetKey() string {
@@ -146,6 +205,20 @@ func (x *PutRequest) GetValue() []byte {
 	return nil
 }
 
+func (x *PutRequest) GetVersion() *Version {
+	if x != nil {
+		return x.Version
+	}
+	return nil
+}
+
+func (x *PutRequest) GetExpected() *Version {
+	if x != nil {
+		return x.Expected
+	}
+	return nil
+}
+
 type PutResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -154,7 +227,7 @@ type PutResponse struct {
 
 func (x *PutResponse) Reset() {
 	*x = PutResponse{}
-	mi := &file_protocol_chord_proto_msgTypes[3]
+	mi := &file_protocol_chord_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -166,7 +239,7 @@ func (x *PutResponse) String() string {
 func (*PutResponse) ProtoMessage() {}
 
 func (x *PutResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[3]
+	mi := &file_protocol_chord_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -179,19 +252,233 @@ func (x *PutResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PutResponse.ProtoReflect.Descriptor instead.
 func (*PutResponse) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{3}
+	return file_protocol_chord_proto_rawDescGZIP(), []int{4}
+}
+
+// The first frame of a PutStream carries everything but the value, and
+// every frame a part of the value, in order
+type PutStreamRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Key      string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Version  *Version               `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Expected *Version               `protobuf:"bytes,3,opt,name=expected,proto3" json:"expected,omitempty"`
+	// the length of the whole value
+	Size          int64  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	Data          []byte `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutStreamRequest) Reset() {
+	*x = PutStreamRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutStreamRequest) ProtoMessage() {}
+
+func (x *PutStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutStreamRequest.ProtoReflect.Descriptor instead.
+func (*PutStreamRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PutStreamRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *PutStreamRequest) GetVersion() *Version {
+	if x != nil {
+		return x.Version
+	}
+	return nil
+}
+
+func (x *PutStreamRequest) GetExpected() *Version {
+	if x != nil {
+		return x.Expected
+	}
+	return nil
+}
+
+func (x *PutStreamRequest) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *PutStreamRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type GetStreamRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// where in the value to start
+	Offset        int64 `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStreamRequest) Reset() {
+	*x = GetStreamRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStreamRequest) ProtoMessage() {}
+
+func (x *GetStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStreamRequest.ProtoReflect.Descriptor instead.
+func (*GetStreamRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetStreamRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *GetStreamRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+// The first frame says what the node holds, as in GetResponse, and every
+// frame carries the next part of the value
+type GetStreamResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Found   bool                   `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+	Deleted bool                   `protobuf:"varint,2,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	Version *Version               `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	// the length of the whole value
+	Size          int64  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	Data          []byte `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStreamResponse) Reset() {
+	*x = GetStreamResponse{}
+	mi := &file_protocol_chord_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStreamResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStreamResponse) ProtoMessage() {}
+
+func (x *GetStreamResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStreamResponse.ProtoReflect.Descriptor instead.
+func (*GetStreamResponse) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetStreamResponse) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *GetStreamResponse) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *GetStreamResponse) GetVersion() *Version {
+	if x != nil {
+		return x.Version
+	}
+	return nil
+}
+
+func (x *GetStreamResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *GetStreamResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
 }
 
 type GetRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// leave the value out of the response, for callers that only need to
+	// know whether the key is there and at which version
+	VersionOnly   bool `protobuf:"varint,2,opt,name=version_only,json=versionOnly,proto3" json:"version_only,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GetRequest) Reset() {
 	*x = GetRequest{}
-	mi := &file_protocol_chord_proto_msgTypes[4]
+	mi := &file_protocol_chord_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -203,7 +490,7 @@ func (x *GetRequest) String() string {
 func (*GetRequest) ProtoMessage() {}
 
 func (x *GetRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[4]
+	mi := &file_protocol_chord_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -216,7 +503,7 @@ func (x *GetRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
 func (*GetRequest) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{4}
+	return file_protocol_chord_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *GetRequest) GetKey() string {
@@ -226,16 +513,29 @@ func (x *GetRequest) GetKey() string {
 	return ""
 }
 
+func (x *GetRequest) GetVersionOnly() bool {
+	if x != nil {
+		return x.VersionOnly
+	}
+	return false
+}
+
 type GetResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Value         []byte                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// empty for a deleted key
+	Value   []byte `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Deleted bool   `protobuf:"varint,3,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	// whether the node holds the key at all, tombstones included
+	Found bool `protobuf:"varint,4,opt,name=found,proto3" json:"found,omitempty"`
+	// so that readers asking several replicas can pick the newest
+	Version       *Version `protobuf:"bytes,5,opt,name=version,proto3" json:"version,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GetResponse) Reset() {
 	*x = GetResponse{}
-	mi := &file_protocol_chord_proto_msgTypes[5]
+	mi := &file_protocol_chord_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -247,7 +547,7 @@ func (x *GetResponse) String() string {
 func (*GetResponse) ProtoMessage() {}
 
 func (x *GetResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[5]
+	mi := &file_protocol_chord_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -260,7 +560,7 @@ func (x *GetResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetResponse.ProtoReflect.Descriptor instead.
 func (*GetResponse) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{5}
+	return file_protocol_chord_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *GetResponse) GetValue() []byte {
@@ -270,28 +570,680 @@ func (x *GetResponse) GetValue() []byte {
 	return nil
 }
 
+func (x *GetResponse) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *GetResponse) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *GetResponse) GetVersion() *Version {
+	if x != nil {
+		return x.Version
+	}
+	return nil
+}
+
 type DeleteRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Key     string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Version *Version               `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	// as in PutRequest
+	Expected      *Version `protobuf:"bytes,4,opt,name=expected,proto3" json:"expected,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *DeleteRequest) Reset() {
 	*x = DeleteRequest{}
-	mi := &file_protocol_chord_proto_msgTypes[6]
+	mi := &file_protocol_chord_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *DeleteRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *DeleteRequest) GetVersion() *Version {
+	if x != nil {
+		return x.Version
+	}
+	return nil
+}
+
+func (x *DeleteRequest) GetExpected() *Version {
+	if x != nil {
+		return x.Expected
+	}
+	return nil
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_protocol_chord_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{11}
+}
+
+type GetAllRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ids are fixed width (20 bytes), so an empty start and end means no range
+	Start         []byte `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           []byte `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAllRequest) Reset() {
+	*x = GetAllRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAllRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAllRequest) ProtoMessage() {}
+
+func (x *GetAllRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAllRequest.ProtoReflect.Descriptor instead.
+func (*GetAllRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetAllRequest) GetStart() []byte {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *GetAllRequest) GetEnd() []byte {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+// Items whose values fit in a frame come in batches. A larger one comes on
+// its own: its first frame has the item without its value, the length of
+// the value in size and the start of it in data, and the frames after it
+// only the rest of the value.
+type GetAllResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// the items with their versions, tombstones of deleted keys included
+	Items         []*Item `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	Size          int64   `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	Data          []byte  `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAllResponse) Reset() {
+	*x = GetAllResponse{}
+	mi := &file_protocol_chord_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAllResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAllResponse) ProtoMessage() {}
+
+func (x *GetAllResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAllResponse.ProtoReflect.Descriptor instead.
+func (*GetAllResponse) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *GetAllResponse) GetItems() []*Item {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *GetAllResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *GetAllResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ListKeysRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// as in GetAllRequest
+	Start []byte `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End   []byte `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	// only the keys holding files, not their chunks or content
+	FilesOnly     bool `protobuf:"varint,3,opt,name=files_only,json=filesOnly,proto3" json:"files_only,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListKeysRequest) Reset() {
+	*x = ListKeysRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListKeysRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListKeysRequest) ProtoMessage() {}
+
+func (x *ListKeysRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListKeysRequest.ProtoReflect.Descriptor instead.
+func (*ListKeysRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ListKeysRequest) GetStart() []byte {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *ListKeysRequest) GetEnd() []byte {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *ListKeysRequest) GetFilesOnly() bool {
+	if x != nil {
+		return x.FilesOnly
+	}
+	return false
+}
+
+type ListKeysResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keys          []*KeyInfo             `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListKeysResponse) Reset() {
+	*x = ListKeysResponse{}
+	mi := &file_protocol_chord_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListKeysResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListKeysResponse) ProtoMessage() {}
+
+func (x *ListKeysResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListKeysResponse.ProtoReflect.Descriptor instead.
+func (*ListKeysResponse) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ListKeysResponse) GetKeys() []*KeyInfo {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type KeyInfo struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Key     string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Version *Version               `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Deleted bool                   `protobuf:"varint,3,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	// the size of the file the key holds, as its manifest tells, or -1
+	Size          int64 `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyInfo) Reset() {
+	*x = KeyInfo{}
+	mi := &file_protocol_chord_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyInfo) ProtoMessage() {}
+
+func (x *KeyInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyInfo.ProtoReflect.Descriptor instead.
+func (*KeyInfo) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *KeyInfo) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *KeyInfo) GetVersion() *Version {
+	if x != nil {
+		return x.Version
+	}
+	return nil
+}
+
+func (x *KeyInfo) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *KeyInfo) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type Item struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Deleted       bool                   `protobuf:"varint,4,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	Version       *Version               `protobuf:"bytes,5,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Item) Reset() {
+	*x = Item{}
+	mi := &file_protocol_chord_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Item) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Item) ProtoMessage() {}
+
+func (x *Item) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Item.ProtoReflect.Descriptor instead.
+func (*Item) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *Item) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Item) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *Item) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *Item) GetVersion() *Version {
+	if x != nil {
+		return x.Version
+	}
+	return nil
+}
+
+type GetPredecessorRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPredecessorRequest) Reset() {
+	*x = GetPredecessorRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPredecessorRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPredecessorRequest) ProtoMessage() {}
+
+func (x *GetPredecessorRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPredecessorRequest.ProtoReflect.Descriptor instead.
+func (*GetPredecessorRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{18}
+}
+
+type GetPredecessorResponse struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Address    string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Identifier []byte                 `protobuf:"bytes,2,opt,name=identifier,proto3" json:"identifier,omitempty"`
+	Pred       string                 `protobuf:"bytes,3,opt,name=pred,proto3" json:"pred,omitempty"`
+	Successors []string               `protobuf:"bytes,4,rep,name=successors,proto3" json:"successors,omitempty"`
+	// identifiers matching pred and successors, so callers never have to
+	// guess a node's position from its address
+	PredIdentifier       []byte   `protobuf:"bytes,5,opt,name=pred_identifier,json=predIdentifier,proto3" json:"pred_identifier,omitempty"`
+	SuccessorIdentifiers [][]byte `protobuf:"bytes,6,rep,name=successor_identifiers,json=successorIdentifiers,proto3" json:"successor_identifiers,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *GetPredecessorResponse) Reset() {
+	*x = GetPredecessorResponse{}
+	mi := &file_protocol_chord_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPredecessorResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPredecessorResponse) ProtoMessage() {}
+
+func (x *GetPredecessorResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPredecessorResponse.ProtoReflect.Descriptor instead.
+func (*GetPredecessorResponse) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *GetPredecessorResponse) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *GetPredecessorResponse) GetIdentifier() []byte {
+	if x != nil {
+		return x.Identifier
+	}
+	return nil
+}
+
+func (x *GetPredecessorResponse) GetPred() string {
+	if x != nil {
+		return x.Pred
+	}
+	return ""
+}
+
+func (x *GetPredecessorResponse) GetSuccessors() []string {
+	if x != nil {
+		return x.Successors
+	}
+	return nil
+}
+
+func (x *GetPredecessorResponse) GetPredIdentifier() []byte {
+	if x != nil {
+		return x.PredIdentifier
+	}
+	return nil
+}
+
+func (x *GetPredecessorResponse) GetSuccessorIdentifiers() [][]byte {
+	if x != nil {
+		return x.SuccessorIdentifiers
+	}
+	return nil
+}
+
+type NotifyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Address       string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Identifier    []byte                 `protobuf:"bytes,2,opt,name=identifier,proto3" json:"identifier,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NotifyRequest) Reset() {
+	*x = NotifyRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NotifyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NotifyRequest) ProtoMessage() {}
+
+func (x *NotifyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NotifyRequest.ProtoReflect.Descriptor instead.
+func (*NotifyRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *NotifyRequest) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *NotifyRequest) GetIdentifier() []byte {
+	if x != nil {
+		return x.Identifier
+	}
+	return nil
+}
+
+type NotifyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NotifyResponse) Reset() {
+	*x = NotifyResponse{}
+	mi := &file_protocol_chord_proto_msgTypes[21]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *DeleteRequest) String() string {
+func (x *NotifyResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DeleteRequest) ProtoMessage() {}
+func (*NotifyResponse) ProtoMessage() {}
 
-func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[6]
+func (x *NotifyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[21]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -302,39 +1254,33 @@ func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
-func (*DeleteRequest) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{6}
-}
-
-func (x *DeleteRequest) GetKey() string {
-	if x != nil {
-		return x.Key
-	}
-	return ""
+// Deprecated: Use NotifyResponse.ProtoReflect.Descriptor instead.
+func (*NotifyResponse) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{21}
 }
 
-type DeleteResponse struct {
+type FindSuccessorRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            []byte                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *DeleteResponse) Reset() {
-	*x = DeleteResponse{}
-	mi := &file_protocol_chord_proto_msgTypes[7]
+func (x *FindSuccessorRequest) Reset() {
+	*x = FindSuccessorRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[22]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *DeleteResponse) String() string {
+func (x *FindSuccessorRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DeleteResponse) ProtoMessage() {}
+func (*FindSuccessorRequest) ProtoMessage() {}
 
-func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[7]
+func (x *FindSuccessorRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[22]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -345,32 +1291,41 @@ func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
-func (*DeleteResponse) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{7}
+// Deprecated: Use FindSuccessorRequest.ProtoReflect.Descriptor instead.
+func (*FindSuccessorRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{22}
 }
 
-type GetAllRequest struct {
+func (x *FindSuccessorRequest) GetId() []byte {
+	if x != nil {
+		return x.Id
+	}
+	return nil
+}
+
+type FindSuccessorRespons struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	Adress        string                 `protobuf:"bytes,1,opt,name=adress,proto3" json:"adress,omitempty"`
+	Identifier    []byte                 `protobuf:"bytes,2,opt,name=identifier,proto3" json:"identifier,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetAllRequest) Reset() {
-	*x = GetAllRequest{}
-	mi := &file_protocol_chord_proto_msgTypes[8]
+func (x *FindSuccessorRespons) Reset() {
+	*x = FindSuccessorRespons{}
+	mi := &file_protocol_chord_proto_msgTypes[23]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetAllRequest) String() string {
+func (x *FindSuccessorRespons) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetAllRequest) ProtoMessage() {}
+func (*FindSuccessorRespons) ProtoMessage() {}
 
-func (x *GetAllRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[8]
+func (x *FindSuccessorRespons) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[23]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -381,33 +1336,54 @@ func (x *GetAllRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetAllRequest.ProtoReflect.Descriptor instead.
-func (*GetAllRequest) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{8}
+// Deprecated: Use FindSuccessorRespons.ProtoReflect.Descriptor instead.
+func (*FindSuccessorRespons) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{23}
 }
 
-type GetAllResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	KeyValues     map[string][]byte      `protobuf:"bytes,1,rep,name=key_values,json=keyValues,proto3" json:"key_values,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // <-- Change from string to bytes
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (x *FindSuccessorRespons) GetAdress() string {
+	if x != nil {
+		return x.Adress
+	}
+	return ""
 }
 
-func (x *GetAllResponse) Reset() {
-	*x = GetAllResponse{}
-	mi := &file_protocol_chord_proto_msgTypes[9]
+func (x *FindSuccessorRespons) GetIdentifier() []byte {
+	if x != nil {
+		return x.Identifier
+	}
+	return nil
+}
+
+type LeaveRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Address    string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Identifier []byte                 `protobuf:"bytes,2,opt,name=identifier,proto3" json:"identifier,omitempty"`
+	// the leaving node's predecessor, for its successor to adopt
+	Pred           string `protobuf:"bytes,3,opt,name=pred,proto3" json:"pred,omitempty"`
+	PredIdentifier []byte `protobuf:"bytes,4,opt,name=pred_identifier,json=predIdentifier,proto3" json:"pred_identifier,omitempty"`
+	// the leaving node's successor list, for its predecessor to adopt
+	Successors           []string `protobuf:"bytes,5,rep,name=successors,proto3" json:"successors,omitempty"`
+	SuccessorIdentifiers [][]byte `protobuf:"bytes,6,rep,name=successor_identifiers,json=successorIdentifiers,proto3" json:"successor_identifiers,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *LeaveRequest) Reset() {
+	*x = LeaveRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[24]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetAllResponse) String() string {
+func (x *LeaveRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetAllResponse) ProtoMessage() {}
+func (*LeaveRequest) ProtoMessage() {}
 
-func (x *GetAllResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[9]
+func (x *LeaveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[24]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -418,39 +1394,74 @@ func (x *GetAllResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetAllResponse.ProtoReflect.Descriptor instead.
-func (*GetAllResponse) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{9}
+// Deprecated: Use LeaveRequest.ProtoReflect.Descriptor instead.
+func (*LeaveRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *LeaveRequest) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
 }
 
-func (x *GetAllResponse) GetKeyValues() map[string][]byte {
+func (x *LeaveRequest) GetIdentifier() []byte {
 	if x != nil {
-		return x.KeyValues
+		return x.Identifier
 	}
 	return nil
 }
 
-type GetPredecessorRequest struct {
+func (x *LeaveRequest) GetPred() string {
+	if x != nil {
+		return x.Pred
+	}
+	return ""
+}
+
+func (x *LeaveRequest) GetPredIdentifier() []byte {
+	if x != nil {
+		return x.PredIdentifier
+	}
+	return nil
+}
+
+func (x *LeaveRequest) GetSuccessors() []string {
+	if x != nil {
+		return x.Successors
+	}
+	return nil
+}
+
+func (x *LeaveRequest) GetSuccessorIdentifiers() [][]byte {
+	if x != nil {
+		return x.SuccessorIdentifiers
+	}
+	return nil
+}
+
+type LeaveResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetPredecessorRequest) Reset() {
-	*x = GetPredecessorRequest{}
-	mi := &file_protocol_chord_proto_msgTypes[10]
+func (x *LeaveResponse) Reset() {
+	*x = LeaveResponse{}
+	mi := &file_protocol_chord_proto_msgTypes[25]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetPredecessorRequest) String() string {
+func (x *LeaveResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetPredecessorRequest) ProtoMessage() {}
+func (*LeaveResponse) ProtoMessage() {}
 
-func (x *GetPredecessorRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[10]
+func (x *LeaveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[25]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -461,36 +1472,39 @@ func (x *GetPredecessorRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetPredecessorRequest.ProtoReflect.Descriptor instead.
-func (*GetPredecessorRequest) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{10}
+// Deprecated: Use LeaveResponse.ProtoReflect.Descriptor instead.
+func (*LeaveResponse) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{25}
 }
 
-type GetPredecessorResponse struct {
+// The Merkle tree over the keys in (start, end] has 2^depth leaves, each
+// covering an equal part of the range. Its nodes are numbered from the
+// root, 0, with the children of node i at 2i+1 and 2i+2.
+type MerkleTreeRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Address       string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
-	Identifier    []byte                 `protobuf:"bytes,2,opt,name=identifier,proto3" json:"identifier,omitempty"`
-	Pred          string                 `protobuf:"bytes,3,opt,name=pred,proto3" json:"pred,omitempty"`
-	Successors    []string               `protobuf:"bytes,4,rep,name=successors,proto3" json:"successors,omitempty"`
+	Start         []byte                 `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           []byte                 `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	Depth         uint32                 `protobuf:"varint,3,opt,name=depth,proto3" json:"depth,omitempty"`
+	Nodes         []uint32               `protobuf:"varint,4,rep,packed,name=nodes,proto3" json:"nodes,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetPredecessorResponse) Reset() {
-	*x = GetPredecessorResponse{}
-	mi := &file_protocol_chord_proto_msgTypes[11]
+func (x *MerkleTreeRequest) Reset() {
+	*x = MerkleTreeRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[26]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetPredecessorResponse) String() string {
+func (x *MerkleTreeRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetPredecessorResponse) ProtoMessage() {}
+func (*MerkleTreeRequest) ProtoMessage() {}
 
-func (x *GetPredecessorResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[11]
+func (x *MerkleTreeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[26]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -501,61 +1515,62 @@ func (x *GetPredecessorResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetPredecessorResponse.ProtoReflect.Descriptor instead.
-func (*GetPredecessorResponse) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{11}
+// Deprecated: Use MerkleTreeRequest.ProtoReflect.Descriptor instead.
+func (*MerkleTreeRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{26}
 }
 
-func (x *GetPredecessorResponse) GetAddress() string {
+func (x *MerkleTreeRequest) GetStart() []byte {
 	if x != nil {
-		return x.Address
+		return x.Start
 	}
-	return ""
+	return nil
 }
 
-func (x *GetPredecessorResponse) GetIdentifier() []byte {
+func (x *MerkleTreeRequest) GetEnd() []byte {
 	if x != nil {
-		return x.Identifier
+		return x.End
 	}
 	return nil
 }
 
-func (x *GetPredecessorResponse) GetPred() string {
+func (x *MerkleTreeRequest) GetDepth() uint32 {
 	if x != nil {
-		return x.Pred
+		return x.Depth
 	}
-	return ""
+	return 0
 }
 
-func (x *GetPredecessorResponse) GetSuccessors() []string {
+func (x *MerkleTreeRequest) GetNodes() []uint32 {
 	if x != nil {
-		return x.Successors
+		return x.Nodes
 	}
 	return nil
 }
 
-type NotifyRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Address       string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+type MerkleTreeResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// the hashes of the requested nodes, in the same order
+	Hashes        [][]byte `protobuf:"bytes,1,rep,name=hashes,proto3" json:"hashes,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *NotifyRequest) Reset() {
-	*x = NotifyRequest{}
-	mi := &file_protocol_chord_proto_msgTypes[12]
+func (x *MerkleTreeResponse) Reset() {
+	*x = MerkleTreeResponse{}
+	mi := &file_protocol_chord_proto_msgTypes[27]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *NotifyRequest) String() string {
+func (x *MerkleTreeResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*NotifyRequest) ProtoMessage() {}
+func (*MerkleTreeResponse) ProtoMessage() {}
 
-func (x *NotifyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[12]
+func (x *MerkleTreeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[27]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -566,39 +1581,44 @@ func (x *NotifyRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use NotifyRequest.ProtoReflect.Descriptor instead.
-func (*NotifyRequest) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{12}
+// Deprecated: Use MerkleTreeResponse.ProtoReflect.Descriptor instead.
+func (*MerkleTreeResponse) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{27}
 }
 
-func (x *NotifyRequest) GetAddress() string {
+func (x *MerkleTreeResponse) GetHashes() [][]byte {
 	if x != nil {
-		return x.Address
+		return x.Hashes
 	}
-	return ""
+	return nil
 }
 
-type NotifyResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
+type MerkleKeysRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Start []byte                 `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End   []byte                 `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	Depth uint32                 `protobuf:"varint,3,opt,name=depth,proto3" json:"depth,omitempty"`
+	// leaf numbers, from 0 to 2^depth - 1
+	Leaves        []uint32 `protobuf:"varint,4,rep,packed,name=leaves,proto3" json:"leaves,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *NotifyResponse) Reset() {
-	*x = NotifyResponse{}
-	mi := &file_protocol_chord_proto_msgTypes[13]
+func (x *MerkleKeysRequest) Reset() {
+	*x = MerkleKeysRequest{}
+	mi := &file_protocol_chord_proto_msgTypes[28]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *NotifyResponse) String() string {
+func (x *MerkleKeysRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*NotifyResponse) ProtoMessage() {}
+func (*MerkleKeysRequest) ProtoMessage() {}
 
-func (x *NotifyResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[13]
+func (x *MerkleKeysRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[28]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -609,77 +1629,62 @@ func (x *NotifyResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use NotifyResponse.ProtoReflect.Descriptor instead.
-func (*NotifyResponse) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{13}
-}
-
-type FindSuccessorRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            []byte                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
-}
-
-func (x *FindSuccessorRequest) Reset() {
-	*x = FindSuccessorRequest{}
-	mi := &file_protocol_chord_proto_msgTypes[14]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+// Deprecated: Use MerkleKeysRequest.ProtoReflect.Descriptor instead.
+func (*MerkleKeysRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{28}
 }
 
-func (x *FindSuccessorRequest) String() string {
-	return protoimpl.X.MessageStringOf(x)
+func (x *MerkleKeysRequest) GetStart() []byte {
+	if x != nil {
+		return x.Start
+	}
+	return nil
 }
 
-func (*FindSuccessorRequest) ProtoMessage() {}
-
-func (x *FindSuccessorRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[14]
+func (x *MerkleKeysRequest) GetEnd() []byte {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+		return x.End
 	}
-	return mi.MessageOf(x)
+	return nil
 }
 
-// Deprecated: Use FindSuccessorRequest.ProtoReflect.Descriptor instead.
-func (*FindSuccessorRequest) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{14}
+func (x *MerkleKeysRequest) GetDepth() uint32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
 }
 
-func (x *FindSuccessorRequest) GetId() []byte {
+func (x *MerkleKeysRequest) GetLeaves() []uint32 {
 	if x != nil {
-		return x.Id
+		return x.Leaves
 	}
 	return nil
 }
 
-type FindSuccessorRespons struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Adress        string                 `protobuf:"bytes,1,opt,name=adress,proto3" json:"adress,omitempty"`
+type MerkleKeysResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// the keys under the leaves, without their values
+	Items         []*Item `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *FindSuccessorRespons) Reset() {
-	*x = FindSuccessorRespons{}
-	mi := &file_protocol_chord_proto_msgTypes[15]
+func (x *MerkleKeysResponse) Reset() {
+	*x = MerkleKeysResponse{}
+	mi := &file_protocol_chord_proto_msgTypes[29]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *FindSuccessorRespons) String() string {
+func (x *MerkleKeysResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FindSuccessorRespons) ProtoMessage() {}
+func (*MerkleKeysResponse) ProtoMessage() {}
 
-func (x *FindSuccessorRespons) ProtoReflect() protoreflect.Message {
-	mi := &file_protocol_chord_proto_msgTypes[15]
+func (x *MerkleKeysResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_chord_proto_msgTypes[29]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -690,16 +1695,16 @@ func (x *FindSuccessorRespons) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FindSuccessorRespons.ProtoReflect.Descriptor instead.
-func (*FindSuccessorRespons) Descriptor() ([]byte, []int) {
-	return file_protocol_chord_proto_rawDescGZIP(), []int{15}
+// Deprecated: Use MerkleKeysResponse.ProtoReflect.Descriptor instead.
+func (*MerkleKeysResponse) Descriptor() ([]byte, []int) {
+	return file_protocol_chord_proto_rawDescGZIP(), []int{29}
 }
 
-func (x *FindSuccessorRespons) GetAdress() string {
+func (x *MerkleKeysResponse) GetItems() []*Item {
 	if x != nil {
-		return x.Adress
+		return x.Items
 	}
-	return ""
+	return nil
 }
 
 var File_protocol_chord_proto protoreflect.FileDescriptor
@@ -708,28 +1713,72 @@ const file_protocol_chord_proto_rawDesc = "" +
 	"\n" +
 	"\x14protocol/chord.proto\x12\x05chord\"\r\n" +
 	"\vPingRequest\"\x0e\n" +
-	"\fPingResponse\"4\n" +
+	"\fPingResponse\"7\n" +
+	"\aVersion\x12\x14\n" +
+	"\x05clock\x18\x01 \x01(\x04R\x05clock\x12\x16\n" +
+	"\x06writer\x18\x02 \x01(\tR\x06writer\"\x9b\x01\n" +
 	"\n" +
 	"PutRequest\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\fR\x05value\"\r\n" +
-	"\vPutResponse\"\x1e\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\x12(\n" +
+	"\aversion\x18\x04 \x01(\v2\x0e.chord.VersionR\aversion\x12*\n" +
+	"\bexpected\x18\x05 \x01(\v2\x0e.chord.VersionR\bexpectedJ\x04\b\x03\x10\x04R\ttimestamp\"\r\n" +
+	"\vPutResponse\"\xa2\x01\n" +
+	"\x10PutStreamRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12(\n" +
+	"\aversion\x18\x02 \x01(\v2\x0e.chord.VersionR\aversion\x12*\n" +
+	"\bexpected\x18\x03 \x01(\v2\x0e.chord.VersionR\bexpected\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x12\n" +
+	"\x04data\x18\x05 \x01(\fR\x04data\"<\n" +
+	"\x10GetStreamRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\"\x95\x01\n" +
+	"\x11GetStreamResponse\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12\x18\n" +
+	"\adeleted\x18\x02 \x01(\bR\adeleted\x12(\n" +
+	"\aversion\x18\x03 \x01(\v2\x0e.chord.VersionR\aversion\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x12\n" +
+	"\x04data\x18\x05 \x01(\fR\x04data\"A\n" +
 	"\n" +
 	"GetRequest\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\"#\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12!\n" +
+	"\fversion_only\x18\x02 \x01(\bR\vversionOnly\"\x8e\x01\n" +
 	"\vGetResponse\x12\x14\n" +
-	"\x05value\x18\x01 \x01(\fR\x05value\"!\n" +
+	"\x05value\x18\x01 \x01(\fR\x05value\x12\x18\n" +
+	"\adeleted\x18\x03 \x01(\bR\adeleted\x12\x14\n" +
+	"\x05found\x18\x04 \x01(\bR\x05found\x12(\n" +
+	"\aversion\x18\x05 \x01(\v2\x0e.chord.VersionR\aversionJ\x04\b\x02\x10\x03R\ttimestamp\"\x88\x01\n" +
 	"\rDeleteRequest\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\"\x10\n" +
-	"\x0eDeleteResponse\"\x0f\n" +
-	"\rGetAllRequest\"\x93\x01\n" +
-	"\x0eGetAllResponse\x12C\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12(\n" +
+	"\aversion\x18\x03 \x01(\v2\x0e.chord.VersionR\aversion\x12*\n" +
+	"\bexpected\x18\x04 \x01(\v2\x0e.chord.VersionR\bexpectedJ\x04\b\x02\x10\x03R\ttimestamp\"\x10\n" +
+	"\x0eDeleteResponse\"7\n" +
+	"\rGetAllRequest\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\fR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\fR\x03end\"m\n" +
+	"\x0eGetAllResponse\x12!\n" +
+	"\x05items\x18\x02 \x03(\v2\v.chord.ItemR\x05items\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x03R\x04size\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04dataJ\x04\b\x01\x10\x02R\n" +
+	"key_values\"X\n" +
+	"\x0fListKeysRequest\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\fR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\fR\x03end\x12\x1d\n" +
 	"\n" +
-	"key_values\x18\x01 \x03(\v2$.chord.GetAllResponse.KeyValuesEntryR\tkeyValues\x1a<\n" +
-	"\x0eKeyValuesEntry\x12\x10\n" +
+	"files_only\x18\x03 \x01(\bR\tfilesOnly\"6\n" +
+	"\x10ListKeysResponse\x12\"\n" +
+	"\x04keys\x18\x01 \x03(\v2\x0e.chord.KeyInfoR\x04keys\"s\n" +
+	"\aKeyInfo\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12(\n" +
+	"\aversion\x18\x02 \x01(\v2\x0e.chord.VersionR\aversion\x12\x18\n" +
+	"\adeleted\x18\x03 \x01(\bR\adeleted\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\"\x83\x01\n" +
+	"\x04Item\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\fR\x05value:\x028\x01\"\x17\n" +
-	"\x15GetPredecessorRequest\"\x86\x01\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\x12\x18\n" +
+	"\adeleted\x18\x04 \x01(\bR\adeleted\x12(\n" +
+	"\aversion\x18\x05 \x01(\v2\x0e.chord.VersionR\aversionJ\x04\b\x03\x10\x04R\ttimestamp\"\x17\n" +
+	"\x15GetPredecessorRequest\"\xe4\x01\n" +
 	"\x16GetPredecessorResponse\x12\x18\n" +
 	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x1e\n" +
 	"\n" +
@@ -738,23 +1787,65 @@ const file_protocol_chord_proto_rawDesc = "" +
 	"\x04pred\x18\x03 \x01(\tR\x04pred\x12\x1e\n" +
 	"\n" +
 	"successors\x18\x04 \x03(\tR\n" +
-	"successors\")\n" +
+	"successors\x12'\n" +
+	"\x0fpred_identifier\x18\x05 \x01(\fR\x0epredIdentifier\x123\n" +
+	"\x15successor_identifiers\x18\x06 \x03(\fR\x14successorIdentifiers\"I\n" +
 	"\rNotifyRequest\x12\x18\n" +
-	"\aaddress\x18\x01 \x01(\tR\aaddress\"\x10\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x1e\n" +
+	"\n" +
+	"identifier\x18\x02 \x01(\fR\n" +
+	"identifier\"\x10\n" +
 	"\x0eNotifyResponse\"&\n" +
 	"\x14FindSuccessorRequest\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\fR\x02id\".\n" +
+	"\x02id\x18\x01 \x01(\fR\x02id\"N\n" +
 	"\x14FindSuccessorRespons\x12\x16\n" +
-	"\x06adress\x18\x01 \x01(\tR\x06adress2\xd3\x03\n" +
+	"\x06adress\x18\x01 \x01(\tR\x06adress\x12\x1e\n" +
+	"\n" +
+	"identifier\x18\x02 \x01(\fR\n" +
+	"identifier\"\xda\x01\n" +
+	"\fLeaveRequest\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x1e\n" +
+	"\n" +
+	"identifier\x18\x02 \x01(\fR\n" +
+	"identifier\x12\x12\n" +
+	"\x04pred\x18\x03 \x01(\tR\x04pred\x12'\n" +
+	"\x0fpred_identifier\x18\x04 \x01(\fR\x0epredIdentifier\x12\x1e\n" +
+	"\n" +
+	"successors\x18\x05 \x03(\tR\n" +
+	"successors\x123\n" +
+	"\x15successor_identifiers\x18\x06 \x03(\fR\x14successorIdentifiers\"\x0f\n" +
+	"\rLeaveResponse\"g\n" +
+	"\x11MerkleTreeRequest\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\fR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\fR\x03end\x12\x14\n" +
+	"\x05depth\x18\x03 \x01(\rR\x05depth\x12\x14\n" +
+	"\x05nodes\x18\x04 \x03(\rR\x05nodes\",\n" +
+	"\x12MerkleTreeResponse\x12\x16\n" +
+	"\x06hashes\x18\x01 \x03(\fR\x06hashes\"i\n" +
+	"\x11MerkleKeysRequest\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\fR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\fR\x03end\x12\x14\n" +
+	"\x05depth\x18\x03 \x01(\rR\x05depth\x12\x16\n" +
+	"\x06leaves\x18\x04 \x03(\rR\x06leaves\"7\n" +
+	"\x12MerkleKeysResponse\x12!\n" +
+	"\x05items\x18\x01 \x03(\v2\v.chord.ItemR\x05items2\xcc\x06\n" +
 	"\x05Chord\x12/\n" +
 	"\x04Ping\x12\x12.chord.PingRequest\x1a\x13.chord.PingResponse\x12,\n" +
 	"\x03Put\x12\x11.chord.PutRequest\x1a\x12.chord.PutResponse\x12,\n" +
-	"\x03Get\x12\x11.chord.GetRequest\x1a\x12.chord.GetResponse\x125\n" +
-	"\x06Delete\x12\x14.chord.DeleteRequest\x1a\x15.chord.DeleteResponse\x125\n" +
-	"\x06GetAll\x12\x14.chord.GetAllRequest\x1a\x15.chord.GetAllResponse\x12M\n" +
+	"\x03Get\x12\x11.chord.GetRequest\x1a\x12.chord.GetResponse\x12:\n" +
+	"\tPutStream\x12\x17.chord.PutStreamRequest\x1a\x12.chord.PutResponse(\x01\x12@\n" +
+	"\tGetStream\x12\x17.chord.GetStreamRequest\x1a\x18.chord.GetStreamResponse0\x01\x125\n" +
+	"\x06Delete\x12\x14.chord.DeleteRequest\x1a\x15.chord.DeleteResponse\x127\n" +
+	"\x06GetAll\x12\x14.chord.GetAllRequest\x1a\x15.chord.GetAllResponse0\x01\x12=\n" +
+	"\bListKeys\x12\x16.chord.ListKeysRequest\x1a\x17.chord.ListKeysResponse0\x01\x12M\n" +
 	"\x0eGetPredecessor\x12\x1c.chord.GetPredecessorRequest\x1a\x1d.chord.GetPredecessorResponse\x12I\n" +
 	"\rFindSuccessor\x12\x1b.chord.FindSuccessorRequest\x1a\x1b.chord.FindSuccessorRespons\x125\n" +
-	"\x06Notify\x12\x14.chord.NotifyRequest\x1a\x15.chord.NotifyResponseB\fZ\n" +
+	"\x06Notify\x12\x14.chord.NotifyRequest\x1a\x15.chord.NotifyResponse\x122\n" +
+	"\x05Leave\x12\x13.chord.LeaveRequest\x1a\x14.chord.LeaveResponse\x12A\n" +
+	"\n" +
+	"MerkleTree\x12\x18.chord.MerkleTreeRequest\x1a\x19.chord.MerkleTreeResponse\x12A\n" +
+	"\n" +
+	"MerkleKeys\x12\x18.chord.MerkleKeysRequest\x1a\x19.chord.MerkleKeysResponseB\fZ\n" +
 	"./protocolb\x06proto3"
 
 var (
@@ -769,49 +1860,86 @@ func file_protocol_chord_proto_rawDescGZIP() []byte {
 	return file_protocol_chord_proto_rawDescData
 }
 
-var file_protocol_chord_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_protocol_chord_proto_msgTypes = make([]protoimpl.MessageInfo, 30)
 var file_protocol_chord_proto_goTypes = []any{
 	(*PingRequest)(nil),            // 0: chord.PingRequest
 	(*PingResponse)(nil),           // 1: chord.PingResponse
-	(*PutRequest)(nil),             // 2: chord.PutRequest
-	(*PutResponse)(nil),            // 3: chord.PutResponse
-	(*GetRequest)(nil),             // 4: chord.GetRequest
-	(*GetResponse)(nil),            // 5: chord.GetResponse
-	(*DeleteRequest)(nil),          // 6: chord.DeleteRequest
-	(*DeleteResponse)(nil),         // 7: chord.DeleteResponse
-	(*GetAllRequest)(nil),          // 8: chord.GetAllRequest
-	(*GetAllResponse)(nil),         // 9: chord.GetAllResponse
-	(*GetPredecessorRequest)(nil),  // 10: chord.GetPredecessorRequest
-	(*GetPredecessorResponse)(nil), // 11: chord.GetPredecessorResponse
-	(*NotifyRequest)(nil),          // 12: chord.NotifyRequest
-	(*NotifyResponse)(nil),         // 13: chord.NotifyResponse
-	(*FindSuccessorRequest)(nil),   // 14: chord.FindSuccessorRequest
-	(*FindSuccessorRespons)(nil),   // 15: chord.FindSuccessorRespons
-	nil,                            // 16: chord.GetAllResponse.KeyValuesEntry
+	(*Version)(nil),                // 2: chord.Version
+	(*PutRequest)(nil),             // 3: chord.PutRequest
+	(*PutResponse)(nil),            // 4: chord.PutResponse
+	(*PutStreamRequest)(nil),       // 5: chord.PutStreamRequest
+	(*GetStreamRequest)(nil),       // 6: chord.GetStreamRequest
+	(*GetStreamResponse)(nil),      // 7: chord.GetStreamResponse
+	(*GetRequest)(nil),             // 8: chord.GetRequest
+	(*GetResponse)(nil),            // 9: chord.GetResponse
+	(*DeleteRequest)(nil),          // 10: chord.DeleteRequest
+	(*DeleteResponse)(nil),         // 11: chord.DeleteResponse
+	(*GetAllRequest)(nil),          // 12: chord.GetAllRequest
+	(*GetAllResponse)(nil),         // 13: chord.GetAllResponse
+	(*ListKeysRequest)(nil),        // 14: chord.ListKeysRequest
+	(*ListKeysResponse)(nil),       // 15: chord.ListKeysResponse
+	(*KeyInfo)(nil),                // 16: chord.KeyInfo
+	(*Item)(nil),                   // 17: chord.Item
+	(*GetPredecessorRequest)(nil),  // 18: chord.GetPredecessorRequest
+	(*GetPredecessorResponse)(nil), // 19: chord.GetPredecessorResponse
+	(*NotifyRequest)(nil),          // 20: chord.NotifyRequest
+	(*NotifyResponse)(nil),         // 21: chord.NotifyResponse
+	(*FindSuccessorRequest)(nil),   // 22: chord.FindSuccessorRequest
+	(*FindSuccessorRespons)(nil),   // 23: chord.FindSuccessorRespons
+	(*LeaveRequest)(nil),           // 24: chord.LeaveRequest
+	(*LeaveResponse)(nil),          // 25: chord.LeaveResponse
+	(*MerkleTreeRequest)(nil),      // 26: chord.MerkleTreeRequest
+	(*MerkleTreeResponse)(nil),     // 27: chord.MerkleTreeResponse
+	(*MerkleKeysRequest)(nil),      // 28: chord.MerkleKeysRequest
+	(*MerkleKeysResponse)(nil),     // 29: chord.MerkleKeysResponse
 }
 var file_protocol_chord_proto_depIdxs = []int32{
-	16, // 0: chord.GetAllResponse.key_values:type_name -> chord.GetAllResponse.KeyValuesEntry
-	0,  // 1: chord.Chord.Ping:input_type -> chord.PingRequest
-	2,  // 2: chord.Chord.Put:input_type -> chord.PutRequest
-	4,  // 3: chord.Chord.Get:input_type -> chord.GetRequest
-	6,  // 4: chord.Chord.Delete:input_type -> chord.DeleteRequest
-	8,  // 5: chord.Chord.GetAll:input_type -> chord.GetAllRequest
-	10, // 6: chord.Chord.GetPredecessor:input_type -> chord.GetPredecessorRequest
-	14, // 7: chord.Chord.FindSuccessor:input_type -> chord.FindSuccessorRequest
-	12, // 8: chord.Chord.Notify:input_type -> chord.NotifyRequest
-	1,  // 9: chord.Chord.Ping:output_type -> chord.PingResponse
-	3,  // 10: chord.Chord.Put:output_type -> chord.PutResponse
-	5,  // 11: chord.Chord.Get:output_type -> chord.GetResponse
-	7,  // 12: chord.Chord.Delete:output_type -> chord.DeleteResponse
-	9,  // 13: chord.Chord.GetAll:output_type -> chord.GetAllResponse
-	11, // 14: chord.Chord.GetPredecessor:output_type -> chord.GetPredecessorResponse
-	15, // 15: chord.Chord.FindSuccessor:output_type -> chord.FindSuccessorRespons
-	13, // 16: chord.Chord.Notify:output_type -> chord.NotifyResponse
-	9,  // [9:17] is the sub-list for method output_type
-	1,  // [1:9] is the sub-list for method input_type
-	1,  // [1:1] is the sub-list for extension type_name
-	1,  // [1:1] is the sub-list for extension extendee
-	0,  // [0:1] is the sub-list for field type_name
+	2,  // 0: chord.PutRequest.version:type_name -> chord.Version
+	2,  // 1: chord.PutRequest.expected:type_name -> chord.Version
+	2,  // 2: chord.PutStreamRequest.version:type_name -> chord.Version
+	2,  // 3: chord.PutStreamRequest.expected:type_name -> chord.Version
+	2,  // 4: chord.GetStreamResponse.version:type_name -> chord.Version
+	2,  // 5: chord.GetResponse.version:type_name -> chord.Version
+	2,  // 6: chord.DeleteRequest.version:type_name -> chord.Version
+	2,  // 7: chord.DeleteRequest.expected:type_name -> chord.Version
+	17, // 8: chord.GetAllResponse.items:type_name -> chord.Item
+	16, // 9: chord.ListKeysResponse.keys:type_name -> chord.KeyInfo
+	2,  // 10: chord.KeyInfo.version:type_name -> chord.Version
+	2,  // 11: chord.Item.version:type_name -> chord.Version
+	17, // 12: chord.MerkleKeysResponse.items:type_name -> chord.Item
+	0,  // 13: chord.Chord.Ping:input_type -> chord.PingRequest
+	3,  // 14: chord.Chord.Put:input_type -> chord.PutRequest
+	8,  // 15: chord.Chord.Get:input_type -> chord.GetRequest
+	5,  // 16: chord.Chord.PutStream:input_type -> chord.PutStreamRequest
+	6,  // 17: chord.Chord.GetStream:input_type -> chord.GetStreamRequest
+	10, // 18: chord.Chord.Delete:input_type -> chord.DeleteRequest
+	12, // 19: chord.Chord.GetAll:input_type -> chord.GetAllRequest
+	14, // 20: chord.Chord.ListKeys:input_type -> chord.ListKeysRequest
+	18, // 21: chord.Chord.GetPredecessor:input_type -> chord.GetPredecessorRequest
+	22, // 22: chord.Chord.FindSuccessor:input_type -> chord.FindSuccessorRequest
+	20, // 23: chord.Chord.Notify:input_type -> chord.NotifyRequest
+	24, // 24: chord.Chord.Leave:input_type -> chord.LeaveRequest
+	26, // 25: chord.Chord.MerkleTree:input_type -> chord.MerkleTreeRequest
+	28, // 26: chord.Chord.MerkleKeys:input_type -> chord.MerkleKeysRequest
+	1,  // 27: chord.Chord.Ping:output_type -> chord.PingResponse
+	4,  // 28: chord.Chord.Put:output_type -> chord.PutResponse
+	9,  // 29: chord.Chord.Get:output_type -> chord.GetResponse
+	4,  // 30: chord.Chord.PutStream:output_type -> chord.PutResponse
+	7,  // 31: chord.Chord.GetStream:output_type -> chord.GetStreamResponse
+	11, // 32: chord.Chord.Delete:output_type -> chord.DeleteResponse
+	13, // 33: chord.Chord.GetAll:output_type -> chord.GetAllResponse
+	15, // 34: chord.Chord.ListKeys:output_type -> chord.ListKeysResponse
+	19, // 35: chord.Chord.GetPredecessor:output_type -> chord.GetPredecessorResponse
+	23, // 36: chord.Chord.FindSuccessor:output_type -> chord.FindSuccessorRespons
+	21, // 37: chord.Chord.Notify:output_type -> chord.NotifyResponse
+	25, // 38: chord.Chord.Leave:output_type -> chord.LeaveResponse
+	27, // 39: chord.Chord.MerkleTree:output_type -> chord.MerkleTreeResponse
+	29, // 40: chord.Chord.MerkleKeys:output_type -> chord.MerkleKeysResponse
+	27, // [27:41] is the sub-list for method output_type
+	13, // [13:27] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_protocol_chord_proto_init() }
@@ -825,7 +1953,7 @@ func file_protocol_chord_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_protocol_chord_proto_rawDesc), len(file_protocol_chord_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   17,
+			NumMessages:   30,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
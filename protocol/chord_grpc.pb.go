@@ -22,11 +22,17 @@ const (
 	Chord_Ping_FullMethodName           = "/chord.Chord/Ping"
 	Chord_Put_FullMethodName            = "/chord.Chord/Put"
 	Chord_Get_FullMethodName            = "/chord.Chord/Get"
+	Chord_PutStream_FullMethodName      = "/chord.Chord/PutStream"
+	Chord_GetStream_FullMethodName      = "/chord.Chord/GetStream"
 	Chord_Delete_FullMethodName         = "/chord.Chord/Delete"
 	Chord_GetAll_FullMethodName         = "/chord.Chord/GetAll"
+	Chord_ListKeys_FullMethodName       = "/chord.Chord/ListKeys"
 	Chord_GetPredecessor_FullMethodName = "/chord.Chord/GetPredecessor"
 	Chord_FindSuccessor_FullMethodName  = "/chord.Chord/FindSuccessor"
 	Chord_Notify_FullMethodName         = "/chord.Chord/Notify"
+	Chord_Leave_FullMethodName          = "/chord.Chord/Leave"
+	Chord_MerkleTree_FullMethodName     = "/chord.Chord/MerkleTree"
+	Chord_MerkleKeys_FullMethodName     = "/chord.Chord/MerkleKeys"
 )
 
 // ChordClient is the client API for Chord service.
@@ -41,13 +47,32 @@ type ChordClient interface {
 	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
 	// Get retrieves a value for a key
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// PutStream is Put for values too large for one message: the value is
+	// sent in frames, and stored once all of it has arrived
+	PutStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PutStreamRequest, PutResponse], error)
+	// GetStream is Get, streaming the value in frames from an offset on, so
+	// that a transfer that broke off can be resumed where it stopped
+	GetStream(ctx context.Context, in *GetStreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetStreamResponse], error)
 	// Delete removes a key-value pair
 	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
-	// GetAll retrieves all key-value pairs
-	GetAll(ctx context.Context, in *GetAllRequest, opts ...grpc.CallOption) (*GetAllResponse, error)
+	// GetAll streams all items, or only those whose key id lies in
+	// (start, end] when a range is given
+	GetAll(ctx context.Context, in *GetAllRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetAllResponse], error)
+	// ListKeys is GetAll without the values: it streams what the node holds
+	// in a range, for listing files without downloading them
+	ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListKeysResponse], error)
 	GetPredecessor(ctx context.Context, in *GetPredecessorRequest, opts ...grpc.CallOption) (*GetPredecessorResponse, error)
 	FindSuccessor(ctx context.Context, in *FindSuccessorRequest, opts ...grpc.CallOption) (*FindSuccessorRespons, error)
 	Notify(ctx context.Context, in *NotifyRequest, opts ...grpc.CallOption) (*NotifyResponse, error)
+	// Leave tells a neighbour that the sender is leaving the ring, so it can
+	// link to the sender's own neighbours right away
+	Leave(ctx context.Context, in *LeaveRequest, opts ...grpc.CallOption) (*LeaveResponse, error)
+	// MerkleTree returns hashes from the Merkle tree over the keys in a
+	// range, so that two replicas of the range can find where they differ
+	MerkleTree(ctx context.Context, in *MerkleTreeRequest, opts ...grpc.CallOption) (*MerkleTreeResponse, error)
+	// MerkleKeys lists the versions of the keys under some leaves of that
+	// tree, so that only the keys that differ have to be transferred
+	MerkleKeys(ctx context.Context, in *MerkleKeysRequest, opts ...grpc.CallOption) (*MerkleKeysResponse, error)
 }
 
 type chordClient struct {
@@ -88,6 +113,38 @@ func (c *chordClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.Call
 	return out, nil
 }
 
+func (c *chordClient) PutStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PutStreamRequest, PutResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Chord_ServiceDesc.Streams[0], Chord_PutStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PutStreamRequest, PutResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chord_PutStreamClient = grpc.ClientStreamingClient[PutStreamRequest, PutResponse]
+
+func (c *chordClient) GetStream(ctx context.Context, in *GetStreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetStreamResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Chord_ServiceDesc.Streams[1], Chord_GetStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetStreamRequest, GetStreamResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chord_GetStreamClient = grpc.ServerStreamingClient[GetStreamResponse]
+
 func (c *chordClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(DeleteResponse)
@@ -98,16 +155,44 @@ func (c *chordClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grp
 	return out, nil
 }
 
-func (c *chordClient) GetAll(ctx context.Context, in *GetAllRequest, opts ...grpc.CallOption) (*GetAllResponse, error) {
+func (c *chordClient) GetAll(ctx context.Context, in *GetAllRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetAllResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(GetAllResponse)
-	err := c.cc.Invoke(ctx, Chord_GetAll_FullMethodName, in, out, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &Chord_ServiceDesc.Streams[2], Chord_GetAll_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
-	return out, nil
+	x := &grpc.GenericClientStream[GetAllRequest, GetAllResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
 }
 
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chord_GetAllClient = grpc.ServerStreamingClient[GetAllResponse]
+
+func (c *chordClient) ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListKeysResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Chord_ServiceDesc.Streams[3], Chord_ListKeys_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListKeysRequest, ListKeysResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chord_ListKeysClient = grpc.ServerStreamingClient[ListKeysResponse]
+
 func (c *chordClient) GetPredecessor(ctx context.Context, in *GetPredecessorRequest, opts ...grpc.CallOption) (*GetPredecessorResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(GetPredecessorResponse)
@@ -138,6 +223,36 @@ func (c *chordClient) Notify(ctx context.Context, in *NotifyRequest, opts ...grp
 	return out, nil
 }
 
+func (c *chordClient) Leave(ctx context.Context, in *LeaveRequest, opts ...grpc.CallOption) (*LeaveResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LeaveResponse)
+	err := c.cc.Invoke(ctx, Chord_Leave_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chordClient) MerkleTree(ctx context.Context, in *MerkleTreeRequest, opts ...grpc.CallOption) (*MerkleTreeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MerkleTreeResponse)
+	err := c.cc.Invoke(ctx, Chord_MerkleTree_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chordClient) MerkleKeys(ctx context.Context, in *MerkleKeysRequest, opts ...grpc.CallOption) (*MerkleKeysResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MerkleKeysResponse)
+	err := c.cc.Invoke(ctx, Chord_MerkleKeys_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ChordServer is the server API for Chord service.
 // All implementations must embed UnimplementedChordServer
 // for forward compatibility.
@@ -150,13 +265,32 @@ type ChordServer interface {
 	Put(context.Context, *PutRequest) (*PutResponse, error)
 	// Get retrieves a value for a key
 	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// PutStream is Put for values too large for one message: the value is
+	// sent in frames, and stored once all of it has arrived
+	PutStream(grpc.ClientStreamingServer[PutStreamRequest, PutResponse]) error
+	// GetStream is Get, streaming the value in frames from an offset on, so
+	// that a transfer that broke off can be resumed where it stopped
+	GetStream(*GetStreamRequest, grpc.ServerStreamingServer[GetStreamResponse]) error
 	// Delete removes a key-value pair
 	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
-	// GetAll retrieves all key-value pairs
-	GetAll(context.Context, *GetAllRequest) (*GetAllResponse, error)
+	// GetAll streams all items, or only those whose key id lies in
+	// (start, end] when a range is given
+	GetAll(*GetAllRequest, grpc.ServerStreamingServer[GetAllResponse]) error
+	// ListKeys is GetAll without the values: it streams what the node holds
+	// in a range, for listing files without downloading them
+	ListKeys(*ListKeysRequest, grpc.ServerStreamingServer[ListKeysResponse]) error
 	GetPredecessor(context.Context, *GetPredecessorRequest) (*GetPredecessorResponse, error)
 	FindSuccessor(context.Context, *FindSuccessorRequest) (*FindSuccessorRespons, error)
 	Notify(context.Context, *NotifyRequest) (*NotifyResponse, error)
+	// Leave tells a neighbour that the sender is leaving the ring, so it can
+	// link to the sender's own neighbours right away
+	Leave(context.Context, *LeaveRequest) (*LeaveResponse, error)
+	// MerkleTree returns hashes from the Merkle tree over the keys in a
+	// range, so that two replicas of the range can find where they differ
+	MerkleTree(context.Context, *MerkleTreeRequest) (*MerkleTreeResponse, error)
+	// MerkleKeys lists the versions of the keys under some leaves of that
+	// tree, so that only the keys that differ have to be transferred
+	MerkleKeys(context.Context, *MerkleKeysRequest) (*MerkleKeysResponse, error)
 	mustEmbedUnimplementedChordServer()
 }
 
@@ -176,11 +310,20 @@ func (UnimplementedChordServer) Put(context.Context, *PutRequest) (*PutResponse,
 func (UnimplementedChordServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Get not implemented")
 }
+func (UnimplementedChordServer) PutStream(grpc.ClientStreamingServer[PutStreamRequest, PutResponse]) error {
+	return status.Error(codes.Unimplemented, "method PutStream not implemented")
+}
+func (UnimplementedChordServer) GetStream(*GetStreamRequest, grpc.ServerStreamingServer[GetStreamResponse]) error {
+	return status.Error(codes.Unimplemented, "method GetStream not implemented")
+}
 func (UnimplementedChordServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Delete not implemented")
 }
-func (UnimplementedChordServer) GetAll(context.Context, *GetAllRequest) (*GetAllResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "method GetAll not implemented")
+func (UnimplementedChordServer) GetAll(*GetAllRequest, grpc.ServerStreamingServer[GetAllResponse]) error {
+	return status.Error(codes.Unimplemented, "method GetAll not implemented")
+}
+func (UnimplementedChordServer) ListKeys(*ListKeysRequest, grpc.ServerStreamingServer[ListKeysResponse]) error {
+	return status.Error(codes.Unimplemented, "method ListKeys not implemented")
 }
 func (UnimplementedChordServer) GetPredecessor(context.Context, *GetPredecessorRequest) (*GetPredecessorResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method GetPredecessor not implemented")
@@ -191,6 +334,15 @@ func (UnimplementedChordServer) FindSuccessor(context.Context, *FindSuccessorReq
 func (UnimplementedChordServer) Notify(context.Context, *NotifyRequest) (*NotifyResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Notify not implemented")
 }
+func (UnimplementedChordServer) Leave(context.Context, *LeaveRequest) (*LeaveResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Leave not implemented")
+}
+func (UnimplementedChordServer) MerkleTree(context.Context, *MerkleTreeRequest) (*MerkleTreeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method MerkleTree not implemented")
+}
+func (UnimplementedChordServer) MerkleKeys(context.Context, *MerkleKeysRequest) (*MerkleKeysResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method MerkleKeys not implemented")
+}
 func (UnimplementedChordServer) mustEmbedUnimplementedChordServer() {}
 func (UnimplementedChordServer) testEmbeddedByValue()               {}
 
@@ -266,6 +418,24 @@ func _Chord_Get_Handler(srv interface{}, ctx context.Context, dec func(interface
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Chord_PutStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChordServer).PutStream(&grpc.GenericServerStream[PutStreamRequest, PutResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chord_PutStreamServer = grpc.ClientStreamingServer[PutStreamRequest, PutResponse]
+
+func _Chord_GetStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetStreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChordServer).GetStream(m, &grpc.GenericServerStream[GetStreamRequest, GetStreamResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chord_GetStreamServer = grpc.ServerStreamingServer[GetStreamResponse]
+
 func _Chord_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(DeleteRequest)
 	if err := dec(in); err != nil {
@@ -284,24 +454,28 @@ func _Chord_Delete_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Chord_GetAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetAllRequest)
-	if err := dec(in); err != nil {
-		return nil, err
+func _Chord_GetAll_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetAllRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
 	}
-	if interceptor == nil {
-		return srv.(ChordServer).GetAll(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: Chord_GetAll_FullMethodName,
-	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ChordServer).GetAll(ctx, req.(*GetAllRequest))
+	return srv.(ChordServer).GetAll(m, &grpc.GenericServerStream[GetAllRequest, GetAllResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chord_GetAllServer = grpc.ServerStreamingServer[GetAllResponse]
+
+func _Chord_ListKeys_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListKeysRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
 	}
-	return interceptor(ctx, in, info, handler)
+	return srv.(ChordServer).ListKeys(m, &grpc.GenericServerStream[ListKeysRequest, ListKeysResponse]{ServerStream: stream})
 }
 
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chord_ListKeysServer = grpc.ServerStreamingServer[ListKeysResponse]
+
 func _Chord_GetPredecessor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetPredecessorRequest)
 	if err := dec(in); err != nil {
@@ -356,6 +530,60 @@ func _Chord_Notify_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Chord_Leave_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChordServer).Leave(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Chord_Leave_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChordServer).Leave(ctx, req.(*LeaveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Chord_MerkleTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MerkleTreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChordServer).MerkleTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Chord_MerkleTree_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChordServer).MerkleTree(ctx, req.(*MerkleTreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Chord_MerkleKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MerkleKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChordServer).MerkleKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Chord_MerkleKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChordServer).MerkleKeys(ctx, req.(*MerkleKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Chord_ServiceDesc is the grpc.ServiceDesc for Chord service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -379,10 +607,6 @@ var Chord_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Delete",
 			Handler:    _Chord_Delete_Handler,
 		},
-		{
-			MethodName: "GetAll",
-			Handler:    _Chord_GetAll_Handler,
-		},
 		{
 			MethodName: "GetPredecessor",
 			Handler:    _Chord_GetPredecessor_Handler,
@@ -395,7 +619,40 @@ var Chord_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Notify",
 			Handler:    _Chord_Notify_Handler,
 		},
+		{
+			MethodName: "Leave",
+			Handler:    _Chord_Leave_Handler,
+		},
+		{
+			MethodName: "MerkleTree",
+			Handler:    _Chord_MerkleTree_Handler,
+		},
+		{
+			MethodName: "MerkleKeys",
+			Handler:    _Chord_MerkleKeys_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PutStream",
+			Handler:       _Chord_PutStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetStream",
+			Handler:       _Chord_GetStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetAll",
+			Handler:       _Chord_GetAll_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListKeys",
+			Handler:       _Chord_ListKeys_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "protocol/chord.proto",
 }